@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"os"
 
+	"k8s.io/client-go/dynamic"
 	k8s "k8s.io/client-go/kubernetes"
 	rest "k8s.io/client-go/rest"
 	clientcmd "k8s.io/client-go/tools/clientcmd"
 )
 
-func GetKubeClient() *k8s.Clientset { // Capital G to export the function
+// GetRestConfig returns the in-cluster config, or the kubeconfig when running outside a cluster
+func GetRestConfig() *rest.Config {
 	// Try in-cluster config first, fall back to kubeconfig if not found
 	config, err := rest.InClusterConfig()
 	if err != nil {
@@ -24,10 +26,22 @@ func GetKubeClient() *k8s.Clientset { // Capital G to export the function
 			os.Exit(1)
 		}
 	}
+	return config
+}
 
+func GetKubeClient(config *rest.Config) *k8s.Clientset { // Capital G to export the function
 	k8sClient, err := k8s.NewForConfig(config)
 	if err != nil {
 		panic(err.Error())
 	}
 	return k8sClient
 }
+
+// GetDynamicClient returns a client that works with any resource as unstructured objects
+func GetDynamicClient(config *rest.Config) dynamic.Interface {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		panic(err.Error())
+	}
+	return dynamicClient
+}
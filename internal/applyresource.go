@@ -0,0 +1,67 @@
+// logic for the server-side apply strategy
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// FieldManager is the name Mirrorverse writes under in a replica's managedFields.
+const FieldManager = "mirrorverse"
+
+// applyResource creates or updates a replica with server-side apply.
+//
+// For beginners: with server-side apply the API server remembers which fields each
+// "field manager" set. Mirrorverse only owns the fields it applies, so a key removed
+// from the source is removed from the replica, while fields set by Helm, Argo or a
+// human are left alone. If Mirrorverse wants to change a field another manager owns,
+// the API server answers with a conflict instead of silently overwriting it.
+// With force the conflict is overridden and Mirrorverse takes the field over.
+//
+// A conflict without force is reported and not retried: it will not go away on its own.
+//
+// See: https://kubernetes.io/docs/reference/using-api/server-side-apply/
+// It returns the written replica, or a fieldConflictError if it backed off.
+func applyResource(ctx context.Context, client dynamic.NamespaceableResourceInterface, obj *unstructured.Unstructured, namespace, name string, force bool) (*unstructured.Unstructured, error) {
+	// Unstructured objects always carry apiVersion and kind, which apply requires
+	applied := obj.DeepCopy()
+	applied.SetNamespace(namespace)
+	applied.SetManagedFields(nil)
+	data, err := json.Marshal(applied)
+	if err != nil {
+		return nil, err
+	}
+	objtype := obj.GetKind()
+
+	opts := v1.PatchOptions{FieldManager: FieldManager, Force: &force}
+	written, err := client.Namespace(namespace).Patch(ctx, name, types.ApplyPatchType, data, opts)
+	if apierrors.IsConflict(err) && !force {
+		fmt.Printf("Conflict applying %s '%s' in namespace '%s', backing off (set %s to take over): %v\n", objtype, name, namespace, ForceConflictsAnnotation, err)
+		return nil, &fieldConflictError{cause: err}
+	}
+	if err != nil {
+		fmt.Printf("Failed to apply %s '%s' in namespace '%s': %v\n", objtype, name, namespace, err)
+		return nil, err
+	}
+	fmt.Printf("Applied %s '%s' in namespace '%s' as field manager '%s'\n", objtype, name, namespace, FieldManager)
+	return written, nil
+}
+
+// unmarkStale removes mirrorverse.dev/stale from a replica that is a target again.
+// The label was set by a plain update under another field manager, so applying
+// without it would leave it in place.
+func unmarkStale(ctx context.Context, client dynamic.NamespaceableResourceInterface, replica *unstructured.Unstructured) error {
+	patch := []byte(`{"metadata":{"labels":{"mirrorverse.dev/stale":null}}}`)
+	if _, err := client.Namespace(replica.GetNamespace()).Patch(ctx, replica.GetName(), types.MergePatchType, patch, v1.PatchOptions{}); err != nil {
+		fmt.Printf("Failed to remove the stale label of %s '%s' in namespace '%s': %v\n", replica.GetKind(), replica.GetName(), replica.GetNamespace(), err)
+		return err
+	}
+	return nil
+}
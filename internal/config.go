@@ -0,0 +1,92 @@
+// helpers to read mirrorverse.dev/* settings from annotations (and deprecated labels)
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Settings read from a source's annotations and written to a replica's annotations.
+//
+// These used to be labels, but label values are limited to 63 characters and a
+// restricted charset, which is why targets had to be underscore-joined and the
+// last-synced timestamp had to be mangled. Labels of the same name are still read
+// during the deprecation window; the annotation wins when both exist.
+const (
+	TargetsAnnotation        = "mirrorverse.dev/targets"
+	ExcludeAnnotation        = "mirrorverse.dev/exclude"
+	StrategyAnnotation       = "mirrorverse.dev/strategy"
+	CleanupAnnotation        = "mirrorverse.dev/cleanup"
+	ForceConflictsAnnotation = "mirrorverse.dev/force-conflicts"
+	SyncSourceRefAnnotation  = "mirrorverse.dev/sync-source-ref"
+	LastSyncedAnnotation     = "mirrorverse.dev/last-synced"
+)
+
+// AdoptAnnotation lets a source take over objects of the same name in its target
+// namespaces that Mirrorverse did not create. Without it those are left alone and
+// reported as a conflict. There is no deprecated label for it.
+const AdoptAnnotation = "mirrorverse.dev/adopt"
+
+// GetConfig returns a mirrorverse.dev/* setting of obj and whether it is set.
+// The annotation is read first, then the deprecated label of the same name.
+func GetConfig(obj *unstructured.Unstructured, key string) (string, bool) {
+	if value, ok := obj.GetAnnotations()[key]; ok {
+		return value, true
+	}
+	if value, ok := obj.GetLabels()[key]; ok {
+		return value, true
+	}
+	return "", false
+}
+
+// GetConfigList returns a list setting such as targets or exclude.
+// Annotations accept a comma-separated list ("a, b"), a JSON list (["a","b"]) or a
+// YAML list ("- a\n- b"). Deprecated labels keep their underscore-separated format.
+func GetConfigList(obj *unstructured.Unstructured, key string) []string {
+	if value, ok := obj.GetAnnotations()[key]; ok {
+		list, err := ParseList(value)
+		if err != nil {
+			fmt.Printf("Invalid %s on %s/%s: %v\n", key, obj.GetNamespace(), obj.GetName(), err)
+			return nil
+		}
+		return list
+	}
+	if value, ok := obj.GetLabels()[key]; ok && value != "" {
+		return strings.Split(value, "_")
+	}
+	return nil
+}
+
+// ParseList parses a comma-separated, JSON or YAML list into its trimmed, non-empty items.
+func ParseList(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	var items []string
+	if strings.HasPrefix(value, "[") || strings.HasPrefix(value, "-") {
+		if err := yaml.Unmarshal([]byte(value), &items); err != nil {
+			return nil, err
+		}
+	} else {
+		items = strings.Split(value, ",")
+	}
+	list := []string{}
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, nil
+}
+
+// UsesDeprecatedLabels reports the settings obj still carries as labels instead of annotations.
+func UsesDeprecatedLabels(obj *unstructured.Unstructured) []string {
+	var deprecated []string
+	for _, key := range []string{TargetsAnnotation, ExcludeAnnotation, StrategyAnnotation, CleanupAnnotation, ForceConflictsAnnotation} {
+		if _, ok := obj.GetLabels()[key]; ok {
+			deprecated = append(deprecated, key)
+		}
+	}
+	return deprecated
+}
@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "comma-separated", value: "staging,prod", want: []string{"staging", "prod"}},
+		{name: "spaces and empty items", value: " staging , ,prod, ", want: []string{"staging", "prod"}},
+		{name: "empty", value: "", want: []string{}},
+		{name: "JSON", value: `["staging", "prod"]`, want: []string{"staging", "prod"}},
+		{name: "YAML", value: "- staging\n- prod\n", want: []string{"staging", "prod"}},
+		{name: "patterns are kept as they are", value: "tenant-*,re:^prod-[a-z]+$", want: []string{"tenant-*", "re:^prod-[a-z]+$"}},
+		{name: "invalid JSON", value: `["staging"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseList(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseList(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseList(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
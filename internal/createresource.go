@@ -3,101 +3,212 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/record"
+	"strings"
 )
 
-// GetTargetNamespaces returns the final list of namespaces to apply, giving priority to excludeNamespaces
-func GetTargetNamespaces(targets, exclude string) []string {
-	targetNamespaces := []string{}
-	if targets != "" {
-		targetNamespaces = strings.Split(targets, "_")
-	}
+// errNotOwned means a target namespace already holds an object of the same name that is
+// not a replica of the source. It is skipped rather than retried: it will not go away on its own.
+var errNotOwned = errors.New("object exists and is not managed by this source")
+
+// notOwnedError is errNotOwned carrying the object in the way, so the conflict can be
+// reported on that object too: its owner is the one who can resolve it.
+type notOwnedError struct {
+	existing *unstructured.Unstructured
+}
+
+func (e *notOwnedError) Error() string        { return errNotOwned.Error() }
+func (e *notOwnedError) Is(target error) bool { return target == errNotOwned }
+
+// errFieldConflict means server-side apply refused to change fields owned by another field
+// manager. Like errNotOwned it is reported and not retried, until force-conflicts is set.
+var errFieldConflict = errors.New("fields are owned by another field manager")
+
+// fieldConflictError is errFieldConflict carrying the API server's answer, which names
+// the conflicting fields and their managers.
+type fieldConflictError struct {
+	cause error
+}
+
+func (e *fieldConflictError) Error() string        { return fmt.Sprintf("%v: %v", errFieldConflict, e.cause) }
+func (e *fieldConflictError) Is(target error) bool { return target == errFieldConflict }
+
+// FilterNamespaces trims and de-duplicates targets and drops every excluded namespace
+func FilterNamespaces(targets, exclude []string) []string {
 	excludeNamespaces := map[string]bool{}
-	if exclude != "" {
-		for _, ns := range strings.Split(exclude, "_") {
-			excludeNamespaces[strings.TrimSpace(ns)] = true
-		}
+	for _, ns := range exclude {
+		excludeNamespaces[strings.TrimSpace(ns)] = true
 	}
+	seen := map[string]bool{}
 	finalNamespaces := []string{}
-	for _, ns := range targetNamespaces {
+	for _, ns := range targets {
 		ns = strings.TrimSpace(ns)
-		if ns == "" || excludeNamespaces[ns] {
-			continue // skip if excluded or empty
+		if ns == "" || excludeNamespaces[ns] || seen[ns] {
+			continue // skip if excluded, empty or already listed
 		}
+		seen[ns] = true
 		finalNamespaces = append(finalNamespaces, ns)
 	}
 	return finalNamespaces
 }
 
-func CreateResource(clientset *k8s.Clientset, obj interface{}) {
-	labels := GetLabels(obj)
-	var name, namespace string
-	// Extract namespace from manifest
-	switch o := obj.(type) {
-	case *corev1.ConfigMap:
-		namespace = o.Namespace
-		name = o.Name
-	case *corev1.Secret:
-		namespace = o.Namespace
-		name = o.Name
-	default:
-		fmt.Println("Unsupported resource type")
-		return
-	}
-
-	finalLabels, targets, exclude, strategy := PrepareLabels(labels, namespace, name)
-	UpdateResourceMeta(obj, finalLabels)
+// CreateResource syncs a source into each of the given target namespaces.
+// client must be the dynamic client for the source's resource.
+// Existing objects are only overwritten if they are replicas of this source (or the
+// source sets mirrorverse.dev/adopt); others are skipped and reported as a conflict.
+// It records a Synced Event on every written replica and one on the source, and a
+// SyncFailed or Conflict Event on the source for every namespace that was not synced.
+// It returns the outcome per namespace, and the aggregated errors of all namespaces
+// that failed, so the caller can retry.
+func CreateResource(ctx context.Context, client dynamic.NamespaceableResourceInterface, recorder record.EventRecorder, source *unstructured.Unstructured, finalNamespaces []string) ([]TargetStatus, error) {
+	// Work on a copy, the source itself is needed to check ownership and record events
+	obj := source.DeepCopy()
+	// Replicas of a hashed immutable source are named after their content
+	name := ReplicaName(source)
+	obj.SetName(name)
+	objtype := obj.GetKind()
 
-	// Get final target namespaces (exclude takes priority)
-	finalNamespaces := GetTargetNamespaces(targets, exclude)
+	forceConflicts, _ := GetConfig(obj, ForceConflictsAnnotation)
+	adopt, _ := GetConfig(obj, AdoptAnnotation)
+	finalLabels, finalAnnotations, strategy := PrepareLabels(obj)
+	UpdateResourceMeta(obj, finalLabels, finalAnnotations)
+	if strategy == StrategyMerge3 {
+		SetLastAppliedKeys(obj)
+	}
 
 	// Create in each target namespace
+	var errs []error
+	var synced []string
+	results := make([]TargetStatus, 0, len(finalNamespaces))
 	for _, targetNS := range finalNamespaces {
 		// Set the target namespace for the object
-		var objtype string
-		switch o := obj.(type) {
-		case *corev1.ConfigMap:
-			o.Namespace = targetNS
-			objtype = "configMap"
-		case *corev1.Secret:
-			o.Namespace = targetNS
-			objtype = "Secret"
+		obj.SetNamespace(targetNS)
+		write := func() (*unstructured.Unstructured, error) {
+			if strategy == StrategyApply {
+				// Server-side apply creates and updates in one call
+				fmt.Printf("applying %s '%s' in namespace '%s'...\n", objtype, name, targetNS)
+				existing, err := checkOwnership(ctx, client, source, targetNS, adopt == "true")
+				if err != nil {
+					return nil, err
+				}
+				if existing != nil && IsMarkedAsStale(existing) {
+					if err := unmarkStale(ctx, client, existing); err != nil {
+						return nil, err
+					}
+				}
+				return applyResource(ctx, client, obj, targetNS, name, forceConflicts == "true")
+			}
+			// Try to create, update if already exists
+			fmt.Printf("creating %s '%s' in namespace '%s'...\n", objtype, name, targetNS)
+			return createOrUpdateResource(ctx, client, obj, source, strategy, targetNS, name, adopt == "true")
+		}
+		replica, err := write()
+		if apierrors.IsInvalid(err) {
+			// The data of an immutable replica cannot change: delete it and write it again
+			recreated, recreateErr := recreateImmutableReplica(ctx, client, obj, source, targetNS)
+			if recreateErr != nil {
+				err = recreateErr
+			} else if recreated {
+				replica, err = write()
+			}
 		}
-		// Try to create, update if already exists
-		fmt.Printf("creating %s '%s' in namespace '%s'...\n", objtype, name, targetNS)
-		createOrUpdateResource(clientset, obj, strategy, targetNS, name)
+		result := targetResult(targetNS, err)
+		results = append(results, result)
+		recordSyncResult(objtype, SyncSourceRef(source), result, strategy)
+		var notOwned *notOwnedError
+		var fieldConflict *fieldConflictError
+		switch {
+		case errors.As(err, &notOwned):
+			fmt.Printf("%s '%s' in namespace '%s' is not managed by Mirrorverse, skipping (set %s to take it over)\n", objtype, name, targetNS, AdoptAnnotation)
+			recordEvent(recorder, source, corev1.EventTypeWarning, ReasonConflict,
+				"%s %s/%s exists and is not a replica of this source, not overwriting it (set %s to take it over)", objtype, targetNS, name, AdoptAnnotation)
+			recordEvent(recorder, notOwned.existing, corev1.EventTypeWarning, ReasonConflict,
+				"Not overwritten by %s %s/%s: this object is not a replica of it", objtype, source.GetNamespace(), source.GetName())
+			conflictsTotal.WithLabelValues(objtype, SyncSourceRef(source), targetNS).Inc()
+		case errors.As(err, &fieldConflict):
+			recordEvent(recorder, source, corev1.EventTypeWarning, ReasonConflict,
+				"Fields of %s %s/%s are owned by another field manager, not overwriting them (set %s to take them over): %v", objtype, targetNS, name, ForceConflictsAnnotation, fieldConflict.cause)
+			conflictsTotal.WithLabelValues(objtype, SyncSourceRef(source), targetNS).Inc()
+		case result.State == TargetNamespaceMissing:
+			// Not retried: the namespace handler enqueues the source once the namespace appears
+			fmt.Printf("namespace '%s' does not exist, %s '%s' is synced once it is created\n", targetNS, objtype, name)
+		case err != nil:
+			errs = append(errs, err)
+			recordEvent(recorder, source, corev1.EventTypeWarning, ReasonSyncFailed,
+				"Failed to sync to namespace %s: %v", targetNS, err)
+		default:
+			synced = append(synced, targetNS)
+			if replica != nil {
+				recordEvent(recorder, replica, corev1.EventTypeNormal, ReasonSynced,
+					"Synced from %s %s/%s with strategy %s", objtype, source.GetNamespace(), source.GetName(), strategy)
+			}
+		}
+	}
+	if len(synced) > 0 {
+		recordEvent(recorder, source, corev1.EventTypeNormal, ReasonSynced,
+			"Synced to %s", summarizeNamespaces(synced))
 	}
+	return results, utilerrors.NewAggregate(errs)
 }
 
-// createOrUpdateResource tries to create, and updates if already exists
-func createOrUpdateResource(clientset *k8s.Clientset, obj interface{}, strategy, namespace, name string) error {
-	var err error
-	switch o := obj.(type) {
-	case *corev1.ConfigMap:
-		_, err = clientset.CoreV1().ConfigMaps(namespace).Create(context.TODO(), o, v1.CreateOptions{})
-		if err != nil && apierrors.IsAlreadyExists(err) {
-			fmt.Printf("ConfigMap '%s' already exists in namespace '%s', updating.\n", name, namespace)
-			UpdateResource(clientset, o, strategy, namespace, name)
-			return nil // Return early after update
-		}
-	case *corev1.Secret:
-		_, err = clientset.CoreV1().Secrets(namespace).Create(context.TODO(), o, v1.CreateOptions{})
-		if err != nil && apierrors.IsAlreadyExists(err) {
-			fmt.Printf("Secret '%s' already exists in namespace '%s', updating.\n", name, namespace)
-			UpdateResource(clientset, o, strategy, namespace, name)
-			return nil // Return early after update
+// summarizeNamespaces lists namespaces for an Event message, e.g. "a, b, c and 7 more".
+func summarizeNamespaces(namespaces []string) string {
+	const listed = 5
+	if len(namespaces) <= listed {
+		return strings.Join(namespaces, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(namespaces[:listed], ", "), len(namespaces)-listed)
+}
 
+// checkOwnership returns errNotOwned if the target namespace holds an object of the
+// source's name that is not a replica of the source, unless adopt is set.
+// A missing object is fine: there is nothing to overwrite. It returns the existing
+// object, or nil if there is none.
+func checkOwnership(ctx context.Context, client dynamic.NamespaceableResourceInterface, source *unstructured.Unstructured, namespace string, adopt bool) (*unstructured.Unstructured, error) {
+	existing, err := GetReplicaObject(ctx, client, source, namespace)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !adopt && !IsReplicaOf(existing, source) {
+		return nil, &notOwnedError{existing: existing}
+	}
+	return existing, nil
+}
+
+// createOrUpdateResource tries to create, and updates if already exists and is owned by the source.
+// It returns the written replica.
+func createOrUpdateResource(ctx context.Context, client dynamic.NamespaceableResourceInterface, obj, source *unstructured.Unstructured, strategy, namespace, name string, adopt bool) (*unstructured.Unstructured, error) {
+	created, err := client.Namespace(namespace).Create(ctx, obj, v1.CreateOptions{})
+	if err != nil && apierrors.IsAlreadyExists(err) {
+		existing, err := checkOwnership(ctx, client, source, namespace, adopt)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			// The replace strategy updates the whole object, which custom resources only
+			// accept with the resourceVersion of the live object. obj is shared by all
+			// target namespaces, so it is copied first.
+			obj = obj.DeepCopy()
+			obj.SetResourceVersion(existing.GetResourceVersion())
 		}
+		fmt.Printf("%s '%s' already exists in namespace '%s', updating.\n", obj.GetKind(), name, namespace)
+		return UpdateResource(ctx, client, obj, strategy, namespace, name)
 	}
 	if err != nil {
 		fmt.Printf("Failed to create resource '%s' in namespace '%s': %v\n", name, namespace, err)
 	} else {
 		fmt.Printf("Created resource '%s' in namespace '%s'\n", name, namespace)
 	}
-	return err
+	return created, err
 }
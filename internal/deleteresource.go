@@ -5,70 +5,82 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/record"
 )
 
-func DeleteResource(clientset *kubernetes.Clientset, obj interface{}) {
-	// Implement the logic to delete the resource using the clientset
-	labels := GetLabels(obj)
-	var targets, exclude string
-
-	//check if cleanup is needed
-	// Implement the cleanup logic here
-	for key, value := range labels {
-		if key == "mirrorverse.dev/targets" {
-			targets = value
-		}
-		if key == "mirrorverse.dev/exclude" {
-			exclude = value
-		}
-	}
-	finalNamespaces := GetTargetNamespaces(targets, exclude)
-	objectName := GetName(obj)
-	if labels["mirrorverse.dev/cleanup"] == "true" {
+// DeleteResource runs when a source is gone from the given namespaces: replicas are deleted
+// if cleanup is enabled, otherwise they are marked stale. Replicas that are already gone count as handled,
+// and objects that are not replicas of the source are never touched.
+// Every replica of the source is handled, including old versions of a hashed immutable source.
+// client must be the dynamic client for the source's resource. A ReplicaDeleted Event is
+// recorded on the source for every deleted replica, and a MarkedStale Event on both the
+// source and the replica for every replica marked stale.
+func DeleteResource(ctx context.Context, client dynamic.NamespaceableResourceInterface, recorder record.EventRecorder, obj *unstructured.Unstructured, finalNamespaces []string) error {
+	var errs []error
+	if cleanup, _ := GetConfig(obj, CleanupAnnotation); cleanup == "true" {
 		// If cleanup is true, delete the resource from all target namespaces
 		if len(finalNamespaces) == 0 {
 			fmt.Println("No target namespaces specified for deletion")
-			return
+			return nil
 		}
 		for _, namespace := range finalNamespaces {
-			switch obj.(type) {
-			case *corev1.ConfigMap:
-				err := clientset.CoreV1().ConfigMaps(namespace).Delete(context.TODO(), objectName, metav1.DeleteOptions{})
-				if err != nil {
-					fmt.Printf("Error deleting ConfigMap %s in namespace %s: %v\n", objectName, namespace, err)
-				} else {
-					fmt.Printf("Deleted ConfigMap %s in namespace %s\n", objectName, namespace)
-				}
-			case *corev1.Secret:
-				err := clientset.CoreV1().Secrets(namespace).Delete(context.TODO(), objectName, metav1.DeleteOptions{})
-				if err != nil {
-					fmt.Printf("Error deleting Secret %s in namespace %s: %v\n", objectName, namespace, err)
+			replicas, err := ListReplicas(ctx, client, obj, namespace)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, replica := range replicas {
+				err := client.Namespace(namespace).Delete(ctx, replica.GetName(), metav1.DeleteOptions{})
+				if err != nil && !apierrors.IsNotFound(err) {
+					fmt.Printf("Error deleting %s %s in namespace %s: %v\n", obj.GetKind(), replica.GetName(), namespace, err)
+					errs = append(errs, err)
 				} else {
-					fmt.Printf("Deleted Secret %s in namespace %s\n", objectName, namespace)
+					fmt.Printf("Deleted %s %s in namespace %s\n", obj.GetKind(), replica.GetName(), namespace)
+					recordEvent(recorder, obj, corev1.EventTypeNormal, ReasonReplicaDeleted,
+						"Deleted replica %s/%s", namespace, replica.GetName())
 				}
-			default:
-				fmt.Println("Unsupported resource type for deletion")
 			}
 		}
 	} else {
 		// If cleanup is false, just print the message
-		fmt.Printf("Cleanup is false for %T %s, skipping deletion\n", obj, objectName)
+		fmt.Printf("Cleanup is false for %s %s, skipping deletion\n", obj.GetKind(), obj.GetName())
 		// Add mirrorverse.dev/stale label to all target objects
 		if len(finalNamespaces) == 0 {
 			fmt.Println("No target namespaces specified for marking as stale")
-			return
+			return nil
 		}
 		for _, namespace := range finalNamespaces {
-			// Prepare labels for each target
-			staleLabels := make(map[string]string)
-			for k, v := range labels {
-				staleLabels[k] = v
+			replicas, err := ListReplicas(ctx, client, obj, namespace)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, replica := range replicas {
+				if IsMarkedAsStale(replica) {
+					continue // nothing left to mark
+				}
+				// Keep the replica's own labels and add the stale marker
+				staleLabels := make(map[string]string)
+				for k, v := range replica.GetLabels() {
+					staleLabels[k] = v
+				}
+				staleLabels["mirrorverse.dev/stale"] = "true"
+				if err := UpdateLabels(ctx, replica, client, staleLabels); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				fmt.Printf("Marked %s %s in namespace %s as stale\n", obj.GetKind(), replica.GetName(), namespace)
+				recordEvent(recorder, obj, corev1.EventTypeNormal, ReasonMarkedStale,
+					"Marked replica %s/%s as stale, it is no longer synced", namespace, replica.GetName())
+				recordEvent(recorder, replica, corev1.EventTypeWarning, ReasonMarkedStale,
+					"No longer synced from %s %s/%s, marked as stale", obj.GetKind(), obj.GetNamespace(), obj.GetName())
 			}
-			staleLabels["mirrorverse.dev/stale"] = "true"
-			UpdateLabels(GetSyncSourceObject(clientset,GetName(obj),namespace),clientset, staleLabels)
-			fmt.Printf("Marked %T %s in namespace %s as stale\n", obj, objectName, namespace)
 		}
 	}
+	return utilerrors.NewAggregate(errs)
 }
@@ -1,35 +1,161 @@
+// comparing a replica with its source
 package internal
 
-import corev1 "k8s.io/api/core/v1"
-
-// NeedsSync returns true if any key in the source's Data is missing or different in the replica.
-// For merge/patch strategy: extra keys in the replica are ignored.
-func NeedsSync(replicaObj, sourceObj interface{}) bool {
-	// Handle ConfigMap comparison
-	switch src := sourceObj.(type) {
-	case *corev1.ConfigMap:
-		replica, _ := replicaObj.(*corev1.ConfigMap)
-		// For each key in the source's Data, check if replica has the same key and value
-		for srcKey, srcVal := range src.Data {
-			replicaVal, exists := replica.Data[srcKey]
-			if !exists || replicaVal != srcVal {
-				// Key missing or value different: needs sync
-				return true
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DriftKind says how a field of a replica differs from its source.
+type DriftKind string
+
+const (
+	DriftMissing DriftKind = "missing" // the source has it, the replica does not
+	DriftChanged DriftKind = "changed" // both have it, with different values
+	DriftExtra   DriftKind = "extra"   // the replica has it and should not
+)
+
+// FieldDrift is one difference, e.g. {Path: "data.url", Kind: DriftChanged}.
+type FieldDrift struct {
+	Path string
+	Kind DriftKind
+}
+
+// Drift lists every difference between a replica and its source. Empty means in sync.
+type Drift []FieldDrift
+
+// String renders the drift for logs and events, e.g. "data.url changed, type changed".
+func (d Drift) String() string {
+	parts := make([]string, 0, len(d))
+	for _, f := range d {
+		parts = append(parts, fmt.Sprintf("%s %s", f.Path, f.Kind))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// keyedFields are compared key by key; every other content field (spec, rules, type...) as a whole.
+var keyedFields = []string{"data", "binaryData"}
+
+// DetectDrift compares everything Mirrorverse syncs: the content of the source (data and
+// binaryData key by key, any other field such as a Secret's type or a NetworkPolicy's spec
+// as a whole), the immutable flag, and the labels and annotations propagated from the
+// source (mirrorverse.dev/* keys are bookkeeping and are ignored). Fields a replica must
+// not copy (see StripReplicaFields) are ignored, and so are fields the API server filled
+// in on the replica with a default, so a defaulted replica does not look drifted forever.
+//
+// What counts as drift follows the source's strategy:
+//   - replace: the replica must equal the source, so keys only the replica has are drift too
+//   - merge3: keys Mirrorverse wrote earlier and the source dropped are drift, keys added by tenants are not
+//   - patch and apply: only keys the source has are compared, extra keys are left alone
+func DetectDrift(replica, source *unstructured.Unstructured) Drift {
+	if replica.GroupVersionKind().GroupKind() != source.GroupVersionKind().GroupKind() {
+		return Drift{{Path: "kind", Kind: DriftChanged}}
+	}
+	strategy, _ := GetConfig(source, StrategyAnnotation)
+	extra := strategy == StrategyReplace
+	expected := source.DeepCopy()
+	StripReplicaFields(expected)
+
+	var drift Drift
+	for _, field := range keyedFields {
+		drift = compareMaps(drift, field, nestedMap(expected, field), nestedMap(replica, field), equalValues, extra)
+	}
+	for _, field := range contentFields(expected) {
+		if field == "data" || field == "binaryData" || field == "immutable" {
+			continue
+		}
+		value, ok := replica.Object[field]
+		switch {
+		case !ok:
+			drift = append(drift, FieldDrift{Path: field, Kind: DriftMissing})
+		case !isSubset(expected.Object[field], value):
+			drift = append(drift, FieldDrift{Path: field, Kind: DriftChanged})
+		}
+	}
+	if IsImmutable(expected) != IsImmutable(replica) {
+		drift = append(drift, FieldDrift{Path: "immutable", Kind: DriftChanged})
+	}
+	drift = compareMaps(drift, "labels", propagatedKeys(source.GetLabels()), propagatedKeys(replica.GetLabels()), func(a, b string) bool { return a == b }, extra)
+	drift = compareMaps(drift, "annotations", propagatedKeys(source.GetAnnotations()), propagatedKeys(replica.GetAnnotations()), func(a, b string) bool { return a == b }, extra)
+	if strategy == StrategyMerge3 {
+		drift = append(drift, droppedKeys(replica, source)...)
+	}
+	return drift
+}
+
+// compareMaps appends the drift of one map field. Keys only the replica has count when extra is set.
+func compareMaps[V any](drift Drift, field string, source, replica map[string]V, equal func(a, b V) bool, extra bool) Drift {
+	for _, k := range sortedKeys(source) {
+		replicaVal, ok := replica[k]
+		switch {
+		case !ok:
+			drift = append(drift, FieldDrift{Path: field + "." + k, Kind: DriftMissing})
+		case !equal(source[k], replicaVal):
+			drift = append(drift, FieldDrift{Path: field + "." + k, Kind: DriftChanged})
+		}
+	}
+	if extra {
+		for _, k := range sortedKeys(replica) {
+			if _, ok := source[k]; !ok {
+				drift = append(drift, FieldDrift{Path: field + "." + k, Kind: DriftExtra})
 			}
 		}
-		// All source keys/values are present and match in replica
-		return false
-	case *corev1.Secret:
-		replica, _ := replicaObj.(*corev1.Secret)
-		for srcKey, srcVal := range src.Data {
-			replicaVal, exists := replica.Data[srcKey]
-			if !exists || string(replicaVal) != string(srcVal) {
-				return true
+	}
+	return drift
+}
+
+func equalValues(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// isSubset reports whether every field set in expected has the same value in actual.
+// Fields only actual has are ignored: they were defaulted by the API server. Lists must
+// have the same length, and their items are compared the same way.
+func isSubset(expected, actual interface{}) bool {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range e {
+			if !isSubset(v, a[k]) {
+				return false
 			}
 		}
-		return false
+		return true
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(e) {
+			return false
+		}
+		for i := range e {
+			if !isSubset(e[i], a[i]) {
+				return false
+			}
+		}
+		return true
 	default:
-		// Unknown type: always sync to be safe
-		return false
+		return reflect.DeepEqual(expected, actual)
+	}
+}
+
+// droppedKeys returns the keys the replica still holds that merge3 would remove.
+func droppedKeys(replica, source *unstructured.Unstructured) Drift {
+	removed := removedKeys(GetLastAppliedKeys(replica), sourceKeys(source))
+	var drift Drift
+	for _, k := range removed.Data {
+		if _, ok := nestedMap(replica, "data")[k]; ok {
+			drift = append(drift, FieldDrift{Path: "data." + k, Kind: DriftExtra})
+		}
+	}
+	for _, k := range removed.BinaryData {
+		if _, ok := nestedMap(replica, "binaryData")[k]; ok {
+			drift = append(drift, FieldDrift{Path: "binaryData." + k, Kind: DriftExtra})
+		}
 	}
+	return drift
 }
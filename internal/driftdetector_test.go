@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDetectDrift(t *testing.T) {
+	networkPolicy := func(spec map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "NetworkPolicy",
+			"spec":       spec,
+		}}
+		obj.SetNamespace("default")
+		obj.SetName("deny-all")
+		return obj
+	}
+	strategy := func(s string) map[string]string {
+		return map[string]string{StrategyAnnotation: s}
+	}
+
+	tests := []struct {
+		name    string
+		source  *unstructured.Unstructured
+		replica *unstructured.Unstructured
+		want    Drift
+	}{
+		{
+			name:    "in sync",
+			source:  configMap("default", "app", nil, strategy(StrategyPatch), map[string]interface{}{"a": "1"}),
+			replica: configMap("staging", "app", nil, nil, map[string]interface{}{"a": "1"}),
+		},
+		{
+			name:    "changed and missing keys",
+			source:  configMap("default", "app", nil, strategy(StrategyPatch), map[string]interface{}{"a": "1", "b": "2"}),
+			replica: configMap("staging", "app", nil, nil, map[string]interface{}{"a": "changed"}),
+			want:    Drift{{Path: "data.a", Kind: DriftChanged}, {Path: "data.b", Kind: DriftMissing}},
+		},
+		{
+			name:    "patch keeps extra keys",
+			source:  configMap("default", "app", nil, strategy(StrategyPatch), map[string]interface{}{"a": "1"}),
+			replica: configMap("staging", "app", nil, nil, map[string]interface{}{"a": "1", "tenant": "x"}),
+		},
+		{
+			name:    "replace reports extra keys",
+			source:  configMap("default", "app", nil, strategy(StrategyReplace), map[string]interface{}{"a": "1"}),
+			replica: configMap("staging", "app", nil, nil, map[string]interface{}{"a": "1", "tenant": "x"}),
+			want:    Drift{{Path: "data.tenant", Kind: DriftExtra}},
+		},
+		{
+			name:    "replace reports extra labels",
+			source:  configMap("default", "app", nil, strategy(StrategyReplace), nil),
+			replica: configMap("staging", "app", map[string]string{"team": "a"}, nil, nil),
+			want:    Drift{{Path: "labels.team", Kind: DriftExtra}},
+		},
+		{
+			name:   "merge3 reports keys the source dropped, not keys tenants added",
+			source: configMap("default", "app", nil, strategy(StrategyMerge3), map[string]interface{}{"a": "1"}),
+			replica: configMap("staging", "app", nil, map[string]string{LastAppliedKeysAnnotation: `{"data":["a","old"]}`},
+				map[string]interface{}{"a": "1", "old": "2", "tenant": "x"}),
+			want: Drift{{Path: "data.old", Kind: DriftExtra}},
+		},
+		{
+			name:    "changed label, bookkeeping ignored",
+			source:  configMap("default", "app", map[string]string{"team": "a", "mirrorverse.dev/sync-source": "true"}, strategy(StrategyPatch), nil),
+			replica: configMap("staging", "app", map[string]string{"team": "b", "mirrorverse.dev/sync-replica": "true"}, nil, nil),
+			want:    Drift{{Path: "labels.team", Kind: DriftChanged}},
+		},
+		{
+			name:    "fields defaulted by the API server are ignored",
+			source:  networkPolicy(map[string]interface{}{"podSelector": map[string]interface{}{}}),
+			replica: networkPolicy(map[string]interface{}{"podSelector": map[string]interface{}{}, "policyTypes": []interface{}{"Ingress"}}),
+		},
+		{
+			name:    "changed spec",
+			source:  networkPolicy(map[string]interface{}{"policyTypes": []interface{}{"Ingress"}}),
+			replica: networkPolicy(map[string]interface{}{"policyTypes": []interface{}{"Egress"}}),
+			want:    Drift{{Path: "spec", Kind: DriftChanged}},
+		},
+		{
+			name:    "different kind",
+			source:  configMap("default", "app", nil, nil, nil),
+			replica: networkPolicy(map[string]interface{}{}),
+			want:    Drift{{Path: "kind", Kind: DriftChanged}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectDrift(tt.replica, tt.source)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DetectDrift = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDriftString(t *testing.T) {
+	d := Drift{{Path: "data.url", Kind: DriftChanged}, {Path: "type", Kind: DriftMissing}}
+	if got, want := d.String(), "data.url changed, type missing"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
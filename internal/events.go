@@ -0,0 +1,41 @@
+// Kubernetes Events recorded on sources and replicas
+package internal
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Event reasons, shown by `kubectl describe` and `kubectl get events`.
+// Events are recorded on the source and, where it still exists, on the replica.
+const (
+	ReasonSynced         = "Synced"         // a replica was written
+	ReasonSyncFailed     = "SyncFailed"     // writing a replica failed, it is retried
+	ReasonConflict       = "Conflict"       // an object not managed by the source is in the way
+	ReasonMarkedStale    = "MarkedStale"    // a replica lost its source and is no longer synced
+	ReasonReplicaDeleted = "ReplicaDeleted" // a replica was deleted (cleanup, pruning, old immutable versions)
+	ReasonDriftRepaired  = "DriftRepaired"  // a replica that was changed by hand was synced again
+	ReasonRefused        = "Refused"        // the source may not be mirrored (RBAC objects, see rbacSourceAllowed)
+)
+
+// NewEventRecorder returns a recorder that writes Events as the "mirrorverse" component.
+//
+// For beginners: an Event is a small object attached to another object. The recorder
+// sends them in the background and merges repeated ones, so recording is cheap.
+func NewEventRecorder(clientset *kubernetes.Clientset) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "mirrorverse"})
+}
+
+// recordEvent records an Event on a source or replica.
+func recordEvent(recorder record.EventRecorder, obj *unstructured.Unstructured, eventType, reason, messageFmt string, args ...interface{}) {
+	if recorder == nil {
+		return
+	}
+	recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+}
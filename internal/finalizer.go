@@ -0,0 +1,102 @@
+// finalizer that makes sure a deleted source always gets its replicas cleaned up
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// CleanupFinalizer is added to every source. Kubernetes keeps a deleted source around
+// (with a deletionTimestamp) until Mirrorverse has deleted or marked stale its replicas
+// and removed the finalizer, so a deletion that happens while the controller is down
+// is handled once it is back.
+//
+// If a source is stuck because cleanup keeps failing, removing the finalizer by hand
+// lets the deletion go through, e.g.:
+//
+//	kubectl patch configmap my-config --type=json -p='[{"op":"remove","path":"/metadata/finalizers/0"}]'
+const CleanupFinalizer = "mirrorverse.dev/cleanup"
+
+// Returns if an object is being deleted
+func IsBeingDeleted(obj *unstructured.Unstructured) bool {
+	return obj.GetDeletionTimestamp() != nil
+}
+
+// HasCleanupFinalizer reports whether obj carries the mirrorverse.dev/cleanup finalizer.
+func HasCleanupFinalizer(obj *unstructured.Unstructured) bool {
+	for _, f := range obj.GetFinalizers() {
+		if f == CleanupFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// AddCleanupFinalizer adds the mirrorverse.dev/cleanup finalizer to a source.
+func AddCleanupFinalizer(ctx context.Context, client dynamic.NamespaceableResourceInterface, obj *unstructured.Unstructured) error {
+	if HasCleanupFinalizer(obj) {
+		return nil
+	}
+	return updateFinalizers(ctx, client, obj, append(obj.GetFinalizers(), CleanupFinalizer))
+}
+
+// RemoveCleanupFinalizer removes the mirrorverse.dev/cleanup finalizer, letting a pending deletion finish.
+func RemoveCleanupFinalizer(ctx context.Context, client dynamic.NamespaceableResourceInterface, obj *unstructured.Unstructured) error {
+	if !HasCleanupFinalizer(obj) {
+		return nil
+	}
+	var finalizers []string
+	for _, f := range obj.GetFinalizers() {
+		if f != CleanupFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	return updateFinalizers(ctx, client, obj, finalizers)
+}
+
+// updateFinalizers writes the finalizer list of obj, and nothing else: obj may carry
+// settings of a MirrorPolicy that must not end up on the source. The patch carries obj's
+// resourceVersion, so a concurrent change makes it fail and the key is retried.
+func updateFinalizers(ctx context.Context, client dynamic.NamespaceableResourceInterface, obj *unstructured.Unstructured, finalizers []string) error {
+	obj.SetFinalizers(finalizers)
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": obj.GetResourceVersion(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.Namespace(obj.GetNamespace()).Patch(ctx, obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		fmt.Printf("Failed to update finalizers of %s/%s: %v\n", obj.GetNamespace(), obj.GetName(), err)
+	}
+	return err
+}
+
+// liveNamespaces drops the namespaces that are gone or being deleted. Their replicas
+// go away with the namespace, and writes into a terminating namespace are rejected,
+// so waiting on them would keep a source's finalizer forever.
+func (w *Watcher) liveNamespaces(namespaces []string) []string {
+	var live []string
+	for _, name := range namespaces {
+		ns, err := w.namespaceLister.Get(name)
+		if err != nil {
+			continue // missing (or not cached yet): nothing to clean up
+		}
+		if ns.Status.Phase == corev1.NamespaceTerminating || ns.DeletionTimestamp != nil {
+			fmt.Printf("Namespace %s is being deleted, skipping its replica\n", name)
+			continue
+		}
+		live = append(live, name)
+	}
+	return live
+}
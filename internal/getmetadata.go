@@ -2,105 +2,94 @@ package internal
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
-	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 )
 
-// Returns the labels of a ConfigMap or Secret, or nil otherwise
-func GetLabels(obj interface{}) map[string]string {
-	switch o := obj.(type) {
-	case *corev1.ConfigMap:
-		return o.Labels
-	case *corev1.Secret:
-		return o.Labels
-	default:
-		return nil
+// Returns the sync source reference from a replica
+func GetSyncSourceRef(obj *unstructured.Unstructured) (name string, namespace string) {
+	ref, ok := GetConfig(obj, SyncSourceRefAnnotation)
+	if !ok || ref == "" {
+		return "", ""
 	}
-}
 
-// Returns the name of a ConfigMap or Secret, or "unknown" if not found
-func GetName(obj interface{}) string {
-	switch o := obj.(type) {
-	case *corev1.ConfigMap:
-		return o.Name
-	case *corev1.Secret:
-		return o.Name
-	default:
-		return "unknown"
+	// Names may contain dots, namespaces may not: split at the last one
+	i := strings.LastIndex(ref, ".")
+	if i <= 0 || i == len(ref)-1 {
+		return "", ""
 	}
-}
 
-// Returns the namespace of a ConfigMap or Secret, or "unknown" if not found
-func GetNamespace(obj interface{}) string {
-	switch o := obj.(type) {
-	case *corev1.ConfigMap:
-		return o.Namespace
-	case *corev1.Secret:
-		return o.Namespace
-	default:
-		return "unknown"
-	}
+	return ref[:i], ref[i+1:]
 }
-// Returns the sync source reference label from a ConfigMap or Secret
-func GetSyncSourceRef(obj interface{}) (name string, namespace string) {
-	labels := GetLabels(obj)
-	if labels == nil {
-		return "", ""
-	}
 
-	ref, ok := labels["mirrorverse.dev/sync-source-ref"]
-	if !ok || ref == "" {
-		return "", ""
-	}
+// SyncSourceRef returns the "<name>.<namespace>" reference replicas of source carry
+func SyncSourceRef(source *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s.%s", source.GetName(), source.GetNamespace())
+}
 
-	parts := strings.SplitN(ref, ".", 2)
-	if len(parts) != 2 {
-		return "", ""
-	}
+// IsReplicaOf reports whether obj is a Mirrorverse replica synced from source
+func IsReplicaOf(obj, source *unstructured.Unstructured) bool {
+	name, namespace := GetSyncSourceRef(obj)
+	return IsMirrorverseReplica(obj) && obj.GetKind() == source.GetKind() &&
+		name == source.GetName() && namespace == source.GetNamespace()
+}
 
-	return parts[0], parts[1]
+// GetReplicaObject fetches the object with the source's replica name (see ReplicaName) from another namespace.
+// client must be the dynamic client for the source's resource.
+func GetReplicaObject(ctx context.Context, client dynamic.NamespaceableResourceInterface, source *unstructured.Unstructured, namespace string) (*unstructured.Unstructured, error) {
+	return client.Namespace(namespace).Get(ctx, ReplicaName(source), v1.GetOptions{})
 }
 
-//get strategy from labels
-func GetStrategy(obj interface{}) string {
-	labels := GetLabels(obj)
-	if labels == nil {
-		return ""
+// ListReplicas fetches every replica of source in a namespace. There is usually one,
+// named like the source, but an immutable source in hashed mode has one per version.
+func ListReplicas(ctx context.Context, client dynamic.NamespaceableResourceInterface, source *unstructured.Unstructured, namespace string) ([]*unstructured.Unstructured, error) {
+	list, err := client.Namespace(namespace).List(ctx, v1.ListOptions{LabelSelector: "mirrorverse.dev/sync-replica=true"})
+	if err != nil {
+		return nil, err
+	}
+	var owned []*unstructured.Unstructured
+	for i := range list.Items {
+		if IsReplicaOf(&list.Items[i], source) {
+			owned = append(owned, &list.Items[i])
+		}
 	}
-	return labels["mirrorverse.dev/strategy"]
+	return owned, nil
 }
 
-// get object
-func GetSyncSourceObject(clientset *kubernetes.Clientset, name string, namespace string) (obj interface{}) {
-	configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, v1.GetOptions{})
-	if err != nil {
-		return configMap
+// GetSyncSourceObject returns the source a replica was synced from, read through get
+// (usually the informer cache). The replica's kind decides where to look: get must read
+// the replica's resource, since a replica always has the kind of its source.
+// A NotFound error means the replica has no source anymore: its sync-source-ref is missing,
+// the object is gone, or it is no longer labelled as a source. The returned object belongs
+// to the cache and must not be modified.
+func GetSyncSourceObject(get func(namespace, name string) (*unstructured.Unstructured, error), replica *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	name, namespace := GetSyncSourceRef(replica)
+	notFound := apierrors.NewNotFound(schema.GroupResource{Group: replica.GroupVersionKind().Group, Resource: replica.GetKind()}, fmt.Sprintf("%s.%s", name, namespace))
+	if name == "" {
+		return nil, notFound
 	}
-	secret, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, v1.GetOptions{})
+	source, err := get(namespace, name)
 	if err != nil {
-		return secret
-
+		return nil, err
+	}
+	if !HasSyncSourceLabel(source) {
+		return nil, notFound
 	}
-	return nil
+	return source, nil
 }
 
 // Returns if the object is stale
-func IsMarkedAsStale(obj interface{}) bool {
-	labels := GetLabels(obj)
-	if labels == nil {
-		return false
-	}
-	return labels["mirrorverse.dev/stale"] == "true"
+func IsMarkedAsStale(obj *unstructured.Unstructured) bool {
+	return obj.GetLabels()["mirrorverse.dev/stale"] == "true"
 }
 
-func HasSyncSourceRef(obj interface{}) bool {
-	labels := GetLabels(obj)
-	if labels == nil {
-		return false
-	}
-	_, ok := labels["mirrorverse.dev/sync-source-ref"]
+func HasSyncSourceRef(obj *unstructured.Unstructured) bool {
+	_, ok := GetConfig(obj, SyncSourceRefAnnotation)
 	return ok
-}
\ No newline at end of file
+}
@@ -0,0 +1,179 @@
+// support for immutable ConfigMaps and Secrets as sources
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// How changes of an immutable source (`immutable: true`) reach its replicas, set with
+// ImmutableAnnotation. The data of an immutable object can never be updated, so:
+//   - recreate (default): the replica keeps the source's name and is deleted and created again
+//   - hashed: every version is a new replica named "<name>-<hash of the content>", like
+//     kustomize's configMapGenerator; old versions are deleted after GCGracePeriodAnnotation,
+//     so pods still mounting them keep working while they roll
+const (
+	ImmutableRecreate = "recreate"
+	ImmutableHashed   = "hashed"
+)
+
+const (
+	ImmutableAnnotation     = "mirrorverse.dev/immutable"
+	GCGracePeriodAnnotation = "mirrorverse.dev/gc-grace-period"
+	// SupersededAtAnnotation is set on an old hashed version when it is first seen replaced
+	SupersededAtAnnotation = "mirrorverse.dev/superseded-at"
+)
+
+// DefaultGCGracePeriod is how long an old hashed version is kept after being superseded.
+const DefaultGCGracePeriod = 10 * time.Minute
+
+// Returns if an object is immutable. ConfigMaps and Secrets support `immutable: true`.
+func IsImmutable(obj *unstructured.Unstructured) bool {
+	immutable, _, _ := unstructured.NestedBool(obj.Object, "immutable")
+	return immutable
+}
+
+// ImmutableMode returns how an immutable source is synced, or "" for a mutable one.
+func ImmutableMode(source *unstructured.Unstructured) string {
+	if !IsImmutable(source) {
+		return ""
+	}
+	if mode, _ := GetConfig(source, ImmutableAnnotation); mode == ImmutableHashed {
+		return ImmutableHashed
+	}
+	return ImmutableRecreate
+}
+
+// ContentHash returns a short hash of an object's content (see contentFields), e.g. the
+// data, binaryData and type of a Secret: what can never change on an immutable object.
+func ContentHash(obj *unstructured.Unstructured) string {
+	content := map[string]interface{}{}
+	for _, field := range contentFields(obj) {
+		content[field] = obj.Object[field]
+	}
+	// encoding/json sorts map keys, so equal content always hashes the same
+	raw, _ := json.Marshal(content)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])[:10]
+}
+
+// ReplicaName returns the name replicas of source get: the source's own name,
+// or "<name>-<hash>" for an immutable source in hashed mode.
+func ReplicaName(source *unstructured.Unstructured) string {
+	if ImmutableMode(source) == ImmutableHashed {
+		return source.GetName() + "-" + ContentHash(source)
+	}
+	return source.GetName()
+}
+
+// GCGracePeriod returns how long old hashed versions of source are kept.
+func GCGracePeriod(source *unstructured.Unstructured) time.Duration {
+	value, ok := GetConfig(source, GCGracePeriodAnnotation)
+	if !ok {
+		return DefaultGCGracePeriod
+	}
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace < 0 {
+		fmt.Printf("Invalid %s '%s' on %s/%s, using %s\n", GCGracePeriodAnnotation, value, source.GetNamespace(), source.GetName(), DefaultGCGracePeriod)
+		return DefaultGCGracePeriod
+	}
+	return grace
+}
+
+// recreateImmutableReplica deletes the replica in namespace if it is a replica of source that
+// cannot be updated to obj, the prepared replica, so it can be created again: an immutable
+// replica whose content changed, or one that is unset as immutable, or a Secret whose type changed.
+// It returns false if the replica is something else, leaving the original error to the caller.
+func recreateImmutableReplica(ctx context.Context, client dynamic.NamespaceableResourceInterface, obj, source *unstructured.Unstructured, namespace string) (bool, error) {
+	existing, err := GetReplicaObject(ctx, client, source, namespace)
+	if err != nil || !IsReplicaOf(existing, source) {
+		return false, nil
+	}
+	frozen := IsImmutable(existing) && (ContentHash(existing) != ContentHash(obj) || !IsImmutable(obj))
+	if !frozen && !secretTypeChanged(existing, obj) {
+		return false, nil
+	}
+	fmt.Printf("Replica %s/%s cannot be updated in place, recreating it\n", namespace, existing.GetName())
+	if err := deleteReplica(ctx, client, existing); err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// secretTypeChanged reports whether a Secret's type, which cannot be updated, differs.
+func secretTypeChanged(existing, obj *unstructured.Unstructured) bool {
+	if obj.GroupVersionKind().GroupKind() != (schema.GroupKind{Kind: "Secret"}) {
+		return false
+	}
+	want, _, _ := unstructured.NestedString(obj.Object, "type")
+	have, _, _ := unstructured.NestedString(existing.Object, "type")
+	return want != "" && want != have
+}
+
+// deleteReplica deletes exactly this object: the UID precondition makes sure a
+// replica recreated in the meantime is not deleted by mistake.
+func deleteReplica(ctx context.Context, client dynamic.NamespaceableResourceInterface, replica *unstructured.Unstructured) error {
+	opts := v1.DeleteOptions{Preconditions: v1.NewUIDPreconditions(string(replica.GetUID()))}
+	return client.Namespace(replica.GetNamespace()).Delete(ctx, replica.GetName(), opts)
+}
+
+// collectOldVersions garbage-collects replicas of source in its target namespaces that are
+// not the current version, i.e. earlier hashed versions. The first time one is seen it is
+// annotated with the time, and it is deleted once the grace period has passed since then.
+// The source is enqueued again for when the next old version is due.
+func (w *Watcher) collectOldVersions(ctx context.Context, key resourceKey, source *unstructured.Unstructured, targets []string) error {
+	replicas, err := w.listObjects(key.Resource, replicaSelector)
+	if err != nil {
+		return err
+	}
+	current := ReplicaName(source)
+	grace := GCGracePeriod(source)
+	var next time.Duration
+	for _, replica := range replicas {
+		if replica.GetName() == current || !IsReplicaOf(replica, source) || !containsNamespace(targets, replica.GetNamespace()) {
+			continue
+		}
+		supersededAt, err := time.Parse(time.RFC3339, replica.GetAnnotations()[SupersededAtAnnotation])
+		if err != nil {
+			// Seen replaced for the first time: start the grace period
+			obj := replica.DeepCopy()
+			annotations := map[string]string{}
+			for k, v := range obj.GetAnnotations() {
+				annotations[k] = v
+			}
+			annotations[SupersededAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+			if err := UpdateAnnotations(ctx, obj, w.client(key.Resource), annotations); err != nil {
+				return err
+			}
+			supersededAt = time.Now()
+		}
+		remaining := grace - time.Since(supersededAt)
+		if remaining <= 0 {
+			fmt.Printf("Deleting old version %s/%s of %s\n", replica.GetNamespace(), replica.GetName(), key)
+			if err := deleteReplica(ctx, w.client(key.Resource), replica); err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+			recordEvent(w.recorder, source, corev1.EventTypeNormal, ReasonReplicaDeleted,
+				"Deleted old version %s/%s after the grace period of %s", replica.GetNamespace(), replica.GetName(), grace)
+			continue
+		}
+		if next == 0 || remaining < next {
+			next = remaining
+		}
+	}
+	if next > 0 {
+		w.queue.AddAfter(key, next)
+	}
+	return nil
+}
@@ -1,4 +1,4 @@
-// helpers to parse labels
+// helpers to parse labels and prepare replica metadata
 package internal
 
 import (
@@ -7,125 +7,83 @@ import (
 	"strings"
 	"time"
 
-	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
 )
 
 // Returns true if the object has the sync-source label set to "true"
-func HasSyncSourceLabel(obj interface{}) bool {
-	labels := GetLabels(obj)
-	if labels == nil {
-		return false
-	}
-	return labels["mirrorverse.dev/sync-source"] == "true"
+func HasSyncSourceLabel(obj *unstructured.Unstructured) bool {
+	return obj.GetLabels()["mirrorverse.dev/sync-source"] == "true"
 }
 
-func IsMirrorverseReplica(obj interface{}) bool {
-	labels := GetLabels(obj)
-	if labels == nil {
-		return false
-	}
-	return labels["mirrorverse.dev/sync-replica"] == "true"
+func IsMirrorverseReplica(obj *unstructured.Unstructured) bool {
+	return obj.GetLabels()["mirrorverse.dev/sync-replica"] == "true"
 }
 
+// Helper to clean up metadata and set labels and annotations.
+// What is dropped depends on the kind, see StripReplicaFields.
+func UpdateResourceMeta(obj *unstructured.Unstructured, labels, annotations map[string]string) {
+	StripReplicaFields(obj)
+	obj.SetLabels(labels)
+	obj.SetAnnotations(annotations)
+}
 
-// Helper to clean up metadata and set labels
-func UpdateResourceMeta(obj interface{}, labels map[string]string) {
-	switch o := obj.(type) {
-	case *corev1.ConfigMap:
-		o.Namespace = ""
-		o.Labels = labels
-		o.UID = ""
-		o.ResourceVersion = ""
-		o.CreationTimestamp = v1.Time{}
-		o.ManagedFields = nil
-		if o.Annotations != nil {
-			delete(o.Annotations, "kubectl.kubernetes.io/last-applied-configuration")
-		}
-	case *corev1.Secret:
-		o.Namespace = ""
-		o.Labels = labels
-		o.UID = ""
-		o.ResourceVersion = ""
-		o.CreationTimestamp = v1.Time{}
-		o.ManagedFields = nil
-		if o.Annotations != nil {
-			delete(o.Annotations, "kubectl.kubernetes.io/last-applied-configuration")
-		}
+// Helper to build the labels and annotations of a replica from its source.
+// Every mirrorverse.dev/ key of the source is dropped. The replica is labelled
+// mirrorverse.dev/sync-replica (the only marker that needs to be selectable) and
+// annotated with its source ref, strategy and last-synced time.
+// The returned strategy defaults to patch.
+func PrepareLabels(obj *unstructured.Unstructured) (finalLabels, finalAnnotations map[string]string, strategy string) {
+	cleanLabels := propagatedKeys(obj.GetLabels())
+	cleanAnnotations := propagatedKeys(obj.GetAnnotations())
+	if deprecated := UsesDeprecatedLabels(obj); len(deprecated) > 0 {
+		fmt.Printf("%s/%s configures %v as labels, which is deprecated: use annotations instead\n", obj.GetNamespace(), obj.GetName(), deprecated)
 	}
-}
 
-// Helper to clean up and add managed labels, and parse targets/exclude/strategy
-func PrepareLabels(labels map[string]string, namespace, name string) (finalLabels map[string]string, targets, exclude, strategy string) {
-	cleanLabels := make(map[string]string)
-	for k, v := range labels {
-		if !strings.HasPrefix(k, "mirrorverse.dev/") {
-			cleanLabels[k] = v
-		}
+	// Default to patch and record the strategy on the replica
+	strategy, _ = GetConfig(obj, StrategyAnnotation)
+	if strategy == "" {
+		strategy = StrategyPatch
 	}
-	for key, value := range labels {
-		if key == "mirrorverse.dev/targets" {
-			targets = value
-		}
-		if key == "mirrorverse.dev/exclude" {
-			exclude = value
-		}
-		if key == "mirrorverse.dev/strategy" {
-			strategy = value
+	cleanLabels["mirrorverse.dev/sync-replica"] = "true"
+	cleanAnnotations[SyncSourceRefAnnotation] = SyncSourceRef(obj)
+	cleanAnnotations[LastSyncedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	cleanAnnotations[StrategyAnnotation] = strategy
+
+	return cleanLabels, cleanAnnotations, strategy
+}
+
+// propagatedKeys returns the labels or annotations a source passes on to its replicas:
+// everything except mirrorverse.dev/* keys and kubectl's last-applied-configuration.
+func propagatedKeys(m map[string]string) map[string]string {
+	clean := make(map[string]string)
+	for k, v := range m {
+		if !strings.HasPrefix(k, "mirrorverse.dev/") && k != "kubectl.kubernetes.io/last-applied-configuration" {
+			clean[k] = v
 		}
 	}
-	timeStr := time.Now().Format("2006-01-02T15-04-05Z07.00")
-	timeStr = strings.ReplaceAll(timeStr, "+", "Z")
-	managedLabels := map[string]string{
-		"mirrorverse.dev/sync-replica":    "true",
-		"mirrorverse.dev/sync-source-ref": fmt.Sprintf("%s.%s", name, namespace),
-		"mirrorverse.dev/last-synced":     timeStr,
-	}
-	// Add strategy label if it is empty
-	if strategy != "" {
-		managedLabels["mirrorverse.dev/strategy"] = "patch"
-	}
-	for k, v := range managedLabels {
-		cleanLabels[k] = v
-	}
-	
-	return cleanLabels, targets, exclude, strategy
+	return clean
 }
 
-
-// Helper to update the last-synced label
-func UpdateLabelsLastSynced(obj interface{}, clientset *kubernetes.Clientset) {
-	labels := GetLabels(obj)
-	if labels == nil {
-		return
+// UpdateAnnotations replaces the annotations of obj with the given ones and writes it back.
+func UpdateAnnotations(ctx context.Context, obj *unstructured.Unstructured, client dynamic.NamespaceableResourceInterface, annotations map[string]string) error {
+	obj.SetAnnotations(annotations)
+	_, err := client.Namespace(obj.GetNamespace()).Update(ctx, obj, v1.UpdateOptions{})
+	if err != nil {
+		fmt.Printf("Failed to update annotations of %s/%s: %v\n", obj.GetNamespace(), obj.GetName(), err)
 	}
-	timeStr := time.Now().Format("2006-01-02T15-04-05Z07.00")
-	timeStr = strings.ReplaceAll(timeStr, "+", "Z")
-
-	labels["mirrorverse.dev/last-synced"] = timeStr
-	UpdateLabels(obj, clientset, labels)
+	return err
 }
 
 // update labels on the object
-func UpdateLabels(obj interface{}, clientset *kubernetes.Clientset, labels map[string]string) {
-	switch o := obj.(type) {
-	case *corev1.ConfigMap:
-		o.Labels = labels
-		_, err := clientset.CoreV1().ConfigMaps(GetNamespace(obj)).Update(context.TODO(), obj.(*corev1.ConfigMap), v1.UpdateOptions{})
-		if err != nil {
-			fmt.Printf("Failed to update label: %v\n", err)
-		} else {
-			fmt.Printf("Updated label for %s/%s\n", GetNamespace(obj), GetName(obj))
-		}
-	case *corev1.Secret:
-		o.Labels = labels
-		_, err := clientset.CoreV1().Secrets(GetNamespace(obj)).Update(context.TODO(), obj.(*corev1.Secret), v1.UpdateOptions{})
-		if err != nil {
-			fmt.Printf("Failed to update label: %v\n", err)
-		} else {
-			fmt.Printf("Updated label for %s/%s\n", GetNamespace(obj), GetName(obj))
-		}
+func UpdateLabels(ctx context.Context, obj *unstructured.Unstructured, client dynamic.NamespaceableResourceInterface, labels map[string]string) error {
+	obj.SetLabels(labels)
+	_, err := client.Namespace(obj.GetNamespace()).Update(ctx, obj, v1.UpdateOptions{})
+	if err != nil {
+		fmt.Printf("Failed to update label: %v\n", err)
+	} else {
+		fmt.Printf("Updated label for %s/%s\n", obj.GetNamespace(), obj.GetName())
 	}
-
-}
\ No newline at end of file
+	return err
+}
@@ -0,0 +1,125 @@
+// leader election so only one replica of the controller writes at a time
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderElectionOptions configures the Lease used to pick the active controller.
+type LeaderElectionOptions struct {
+	// LeaseName is the name of the coordination.k8s.io Lease object.
+	LeaseName string
+	// LeaseNamespace is where the Lease lives; empty means the pod's own namespace.
+	LeaseNamespace string
+	// LeaseDuration is how long standbys wait before taking over a lease that stopped being renewed.
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader keeps retrying to renew before giving up leadership.
+	RenewDeadline time.Duration
+	// RetryPeriod is how often candidates try to acquire or renew the lease.
+	RetryPeriod time.Duration
+}
+
+// RunWithLeaderElection blocks and calls run only while this pod holds the Lease.
+//
+// For beginners: every pod of the Deployment races for the same Lease object. The winner
+// renews it every RetryPeriod; the others keep checking. If the leader dies, its lease
+// expires after LeaseDuration and a standby takes over. A leader that cannot renew
+// exits, so two pods never reconcile at the same time.
+//
+// When ctx is cancelled, run gets the same ctx and the lease is only released after run
+// returns, so a standby never starts writing while this pod is still draining.
+func RunWithLeaderElection(ctx context.Context, clientset *kubernetes.Clientset, opts LeaderElectionOptions, run func(ctx context.Context)) error {
+	identity, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("cannot determine leader election identity: %w", err)
+	}
+	namespace := opts.LeaseNamespace
+	if namespace == "" {
+		namespace = currentNamespace()
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      opts.LeaseName,
+			Namespace: namespace,
+		},
+		Client:     clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	// electionCtx keeps renewing the lease until run has returned
+	electionCtx, stopElection := context.WithCancel(context.Background())
+	defer stopElection()
+	var leading, finished int32
+	// NewLeaderElector rejects invalid durations, e.g. a renew deadline that is not
+	// shorter than the lease duration, where RunOrDie would panic
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   opts.LeaseDuration,
+		RenewDeadline:   opts.RenewDeadline,
+		RetryPeriod:     opts.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            opts.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				atomic.StoreInt32(&leading, 1)
+				defer stopElection()
+				if ctx.Err() != nil {
+					return
+				}
+				fmt.Printf("Acquired leadership as %s\n", identity)
+				run(ctx)
+				atomic.StoreInt32(&finished, 1)
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() != nil || atomic.LoadInt32(&finished) == 1 {
+					fmt.Printf("Released leadership as %s\n", identity)
+					return
+				}
+				// Another pod may already be writing; stop right away and let the pod restart as a standby
+				fmt.Printf("Lost leadership as %s, exiting\n", identity)
+				os.Exit(1)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					fmt.Printf("Current leader is %s\n", leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("invalid leader election settings: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		if atomic.LoadInt32(&leading) == 0 {
+			stopElection()
+		}
+	}()
+
+	fmt.Printf("Waiting for leadership of lease %s/%s as %s...\n", namespace, opts.LeaseName, identity)
+	elector.Run(electionCtx)
+	return nil
+}
+
+// currentNamespace returns the namespace the controller runs in, falling back to "default".
+func currentNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if data, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
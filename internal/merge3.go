@@ -0,0 +1,146 @@
+// bookkeeping for the merge3 (three-way merge) strategy
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// LastAppliedKeysAnnotation records on a replica which keys Mirrorverse wrote into it,
+// similar to kubectl's last-applied-configuration. With it, merge3 can tell a key the
+// source dropped (remove it) from a key a tenant added (keep it).
+const LastAppliedKeysAnnotation = "mirrorverse.dev/last-applied-keys"
+
+// appliedKeys lists the keys written by Mirrorverse, per data field.
+type appliedKeys struct {
+	Data       []string `json:"data,omitempty"`
+	BinaryData []string `json:"binaryData,omitempty"`
+}
+
+// sourceKeys returns the keys a source contributes to its replicas. Only the keyed maps
+// `data` and `binaryData` are tracked, so merge3 works like patch for other kinds.
+func sourceKeys(obj *unstructured.Unstructured) appliedKeys {
+	// stringData ends up in data once the API server has stored a Secret
+	data := map[string]bool{}
+	for _, field := range []string{"data", "stringData"} {
+		for k := range nestedMap(obj, field) {
+			data[k] = true
+		}
+	}
+	return appliedKeys{
+		Data:       sortedKeys(data),
+		BinaryData: sortedKeys(nestedMap(obj, "binaryData")),
+	}
+}
+
+// nestedMap returns a top-level map field such as data, or nil if obj has none.
+func nestedMap(obj *unstructured.Unstructured, field string) map[string]interface{} {
+	m, _ := obj.Object[field].(map[string]interface{})
+	return m
+}
+
+// GetLastAppliedKeys reads the keys recorded on a replica. A missing or unreadable
+// annotation means nothing is known, so nothing will be pruned.
+func GetLastAppliedKeys(obj *unstructured.Unstructured) appliedKeys {
+	var keys appliedKeys
+	value, ok := obj.GetAnnotations()[LastAppliedKeysAnnotation]
+	if !ok {
+		return keys
+	}
+	if err := json.Unmarshal([]byte(value), &keys); err != nil {
+		return appliedKeys{}
+	}
+	return keys
+}
+
+// SetLastAppliedKeys records the source's current keys on an object about to be written as a replica.
+func SetLastAppliedKeys(obj *unstructured.Unstructured) {
+	value, err := json.Marshal(sourceKeys(obj))
+	if err != nil {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[LastAppliedKeysAnnotation] = string(value)
+	obj.SetAnnotations(annotations)
+}
+
+// removedKeys returns the keys that were applied last time but are gone from the source now.
+func removedKeys(last, current appliedKeys) appliedKeys {
+	return appliedKeys{
+		Data:       difference(last.Data, current.Data),
+		BinaryData: difference(last.BinaryData, current.BinaryData),
+	}
+}
+
+// buildThreeWayPatch is the merge patch of the patch strategy plus a `null` for every key
+// that Mirrorverse wrote into the live replica before and the source no longer has.
+// obj must already carry the new LastAppliedKeysAnnotation so the next sync starts from it.
+func buildThreeWayPatch(ctx context.Context, client dynamic.NamespaceableResourceInterface, obj *unstructured.Unstructured, namespace, name string) ([]byte, error) {
+	live, err := client.Namespace(namespace).Get(ctx, name, v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := obj.GetAnnotations()[LastAppliedKeysAnnotation]; !ok {
+		SetLastAppliedKeys(obj)
+	}
+
+	mergePatch, err := buildMergePatch(obj)
+	if err != nil {
+		return nil, err
+	}
+	// Round-trip through JSON so the typed data maps can hold nulls
+	patch := map[string]interface{}{}
+	if err := json.Unmarshal(mergePatch, &patch); err != nil {
+		return nil, err
+	}
+	removed := removedKeys(GetLastAppliedKeys(live), sourceKeys(obj))
+	addNulls(patch, "data", removed.Data)
+	addNulls(patch, "binaryData", removed.BinaryData)
+	return json.Marshal(patch)
+}
+
+// addNulls marks keys for deletion inside patch[field].
+func addNulls(patch map[string]interface{}, field string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	values, ok := patch[field].(map[string]interface{})
+	if !ok {
+		values = map[string]interface{}{}
+	}
+	for _, k := range keys {
+		values[k] = nil
+	}
+	patch[field] = values
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func difference(a, b []string) []string {
+	inB := map[string]bool{}
+	for _, k := range b {
+		inB[k] = true
+	}
+	var out []string
+	for _, k := range a {
+		if !inB[k] {
+			out = append(out, k)
+		}
+	}
+	return out
+}
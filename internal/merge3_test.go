@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func TestRemovedKeys(t *testing.T) {
+	tests := []struct {
+		name          string
+		last, current appliedKeys
+		want          appliedKeys
+	}{
+		{
+			name:    "nothing recorded",
+			current: appliedKeys{Data: []string{"a"}},
+		},
+		{
+			name:    "nothing dropped",
+			last:    appliedKeys{Data: []string{"a"}},
+			current: appliedKeys{Data: []string{"a", "b"}},
+		},
+		{
+			name:    "dropped from data and binaryData",
+			last:    appliedKeys{Data: []string{"a", "b"}, BinaryData: []string{"blob"}},
+			current: appliedKeys{Data: []string{"a"}},
+			want:    appliedKeys{Data: []string{"b"}, BinaryData: []string{"blob"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := removedKeys(tt.last, tt.current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("removedKeys = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceKeysIncludesStringData(t *testing.T) {
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"data":       map[string]interface{}{"b": "Yg=="},
+		"stringData": map[string]interface{}{"a": "a"},
+	}}
+	want := appliedKeys{Data: []string{"a", "b"}, BinaryData: []string{}}
+	if got := sourceKeys(secret); !reflect.DeepEqual(got, want) {
+		t.Errorf("sourceKeys = %#v, want %#v", got, want)
+	}
+}
+
+// merge3Replica is a replica last written with keys a and old, to which a tenant added a key.
+func merge3Replica() *unstructured.Unstructured {
+	return configMap("staging", "app", nil, map[string]string{LastAppliedKeysAnnotation: `{"data":["a","old"]}`},
+		map[string]interface{}{"a": "1", "old": "2", "tenant": "x"})
+}
+
+func TestBuildThreeWayPatch(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), merge3Replica())
+	obj := configMap("staging", "app", nil, nil, map[string]interface{}{"a": "new"})
+
+	raw, err := buildThreeWayPatch(context.Background(), client.Resource(configMapGVR), obj, "staging", "app")
+	if err != nil {
+		t.Fatalf("buildThreeWayPatch: %v", err)
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		t.Fatalf("patch is not JSON: %v", err)
+	}
+	wantData := map[string]interface{}{"a": "new", "old": nil}
+	if got := patch["data"]; !reflect.DeepEqual(got, wantData) {
+		t.Errorf("data = %#v, want %#v", got, wantData)
+	}
+	annotations, _, _ := unstructured.NestedStringMap(patch, "metadata", "annotations")
+	if got, want := annotations[LastAppliedKeysAnnotation], `{"data":["a"]}`; got != want {
+		t.Errorf("%s = %s, want %s", LastAppliedKeysAnnotation, got, want)
+	}
+}
+
+func TestUpdateResourceMerge3PrunesDroppedKeys(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), merge3Replica())
+	obj := configMap("staging", "app", nil, nil, map[string]interface{}{"a": "new"})
+
+	if _, err := UpdateResource(context.Background(), client.Resource(configMapGVR), obj, StrategyMerge3, "staging", "app"); err != nil {
+		t.Fatalf("UpdateResource: %v", err)
+	}
+	got, err := client.Resource(configMapGVR).Namespace("staging").Get(context.Background(), "app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get replica: %v", err)
+	}
+	data, _, _ := unstructured.NestedStringMap(got.Object, "data")
+	if want := map[string]string{"a": "new", "tenant": "x"}; !reflect.DeepEqual(data, want) {
+		t.Errorf("data = %v, want %v", data, want)
+	}
+}
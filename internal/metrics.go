@@ -0,0 +1,290 @@
+// Prometheus metrics
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Metrics that concern a target carry the labels source ("<name>.<namespace>", like
+// mirrorverse.dev/sync-source-ref) and namespace (the target), so an alert can name the
+// tenant that fell behind, e.g.:
+//
+//	mirrorverse_target_in_sync == 0
+//	sum by (namespace) (rate(mirrorverse_syncs_total{result!="synced"}[15m])) > 0
+
+// conflictsTotal counts targets Mirrorverse refused to write, per source and target namespace.
+var conflictsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mirrorverse_conflicts_total",
+	Help: "Number of times a replica was not written because the target object is not managed by its source.",
+}, []string{"kind", "source", "namespace"})
+
+// syncsTotal counts syncs into a target namespace by their result (see TargetStatus.State).
+var syncsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mirrorverse_syncs_total",
+	Help: "Number of syncs of a source into a target namespace, by result and strategy.",
+}, []string{"kind", "source", "namespace", "result", "strategy"})
+
+// targetInSync is 1 while the last sync of a source into a target namespace succeeded.
+// The series is dropped once the namespace is no longer a target.
+var targetInSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "mirrorverse_target_in_sync",
+	Help: "1 if the last sync of a source into a target namespace succeeded, 0 otherwise.",
+}, []string{"kind", "source", "namespace"})
+
+// reconcileDuration observes how long a worker took for one queue key.
+var reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "mirrorverse_reconcile_duration_seconds",
+	Help:    "Time it took to reconcile one source, replica or policy, by resource and result.",
+	Buckets: prometheus.ExponentialBuckets(0.005, 2, 14), // 5ms to ~40s
+}, []string{"resource", "result"})
+
+// apiErrorsTotal counts failed requests to the Kubernetes API, see InstrumentTransport.
+var apiErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mirrorverse_api_errors_total",
+	Help: "Number of failed requests to the Kubernetes API, by verb, resource, namespace and HTTP status code.",
+}, []string{"verb", "resource", "namespace", "code"})
+
+func init() {
+	prometheus.MustRegister(conflictsTotal, syncsTotal, targetInSync, reconcileDuration, apiErrorsTotal)
+	workqueue.SetProvider(workqueueMetrics{})
+}
+
+// recordSyncResult updates the sync metrics of one target.
+func recordSyncResult(kind, source string, result TargetStatus, strategy string) {
+	syncsTotal.WithLabelValues(kind, source, result.Namespace, result.State, strategy).Inc()
+	inSync := 0.0
+	if result.State == TargetSynced {
+		inSync = 1
+	}
+	targetInSync.WithLabelValues(kind, source, result.Namespace).Set(inSync)
+}
+
+// forgetTargets drops the per-target series of namespaces a source no longer syncs into.
+// Without namespaces, every target of the source is dropped.
+func forgetTargets(kind, source string, namespaces ...string) {
+	if len(namespaces) == 0 {
+		targetInSync.DeletePartialMatch(prometheus.Labels{"kind": kind, "source": source})
+		return
+	}
+	for _, namespace := range namespaces {
+		targetInSync.DeleteLabelValues(kind, source, namespace)
+	}
+}
+
+// ServeMetrics serves /metrics on addr until ctx is cancelled.
+// It runs on every pod, leader or not, so standbys can be scraped too.
+func ServeMetrics(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	fmt.Printf("Serving metrics on %s/metrics\n", addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// InstrumentTransport wraps the transport of the Kubernetes client so every failed API
+// request is counted in mirrorverse_api_errors_total, except the failures the controller
+// expects (see expectedFailure). Pass it to rest.Config.Wrap.
+func InstrumentTransport(rt http.RoundTripper) http.RoundTripper {
+	return apiErrorCounter{next: rt}
+}
+
+type apiErrorCounter struct {
+	next http.RoundTripper
+}
+
+func (c apiErrorCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := c.next.RoundTrip(req)
+	code := ""
+	switch {
+	case err != nil:
+		code = "error" // no response at all, e.g. a timeout
+	case resp.StatusCode >= 400 && !expectedFailure(req.Method, resp.StatusCode):
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	if code != "" {
+		resource, namespace := parseAPIPath(req.URL.Path)
+		apiErrorsTotal.WithLabelValues(req.Method, resource, namespace, code).Inc()
+	}
+	return resp, err
+}
+
+// expectedFailure tells whether an error status is part of normal operation rather than
+// a problem worth alerting on:
+//   - 409 on POST: the replica exists already, so it is updated instead (createOrUpdateResource)
+//   - 404 on GET: there is no replica yet in a new target (checkOwnership)
+//   - 404 on DELETE: the replica was already gone
+func expectedFailure(method string, code int) bool {
+	switch {
+	case method == http.MethodPost && code == http.StatusConflict:
+		return true
+	case (method == http.MethodGet || method == http.MethodDelete) && code == http.StatusNotFound:
+		return true
+	}
+	return false
+}
+
+// parseAPIPath returns the resource and namespace of an API path, e.g. "configmaps" and
+// "tenant-a" for /api/v1/namespaces/tenant-a/configmaps/app-config. The namespace is
+// empty for cluster-scoped requests.
+func parseAPIPath(path string) (resource, namespace string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	// Skip the group version: /api/v1/... or /apis/<group>/<version>/...
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		parts = parts[3:]
+	default:
+		return "", ""
+	}
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		return parts[2], parts[1]
+	}
+	if len(parts) >= 1 {
+		return parts[0], ""
+	}
+	return "", ""
+}
+
+// objectCollector reports how many sources, replicas and stale replicas the cache holds,
+// per kind and namespace. It counts on every scrape, so the numbers are never stale.
+type objectCollector struct {
+	w *Watcher
+}
+
+var (
+	sourcesDesc       = prometheus.NewDesc("mirrorverse_sources", "Number of sync sources.", []string{"kind", "namespace"}, nil)
+	replicasDesc      = prometheus.NewDesc("mirrorverse_replicas", "Number of replicas, stale ones included.", []string{"kind", "namespace"}, nil)
+	staleReplicasDesc = prometheus.NewDesc("mirrorverse_stale_replicas", "Number of replicas marked mirrorverse.dev/stale.", []string{"kind", "namespace"}, nil)
+)
+
+func (c objectCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sourcesDesc
+	ch <- replicasDesc
+	ch <- staleReplicasDesc
+}
+
+func (c objectCollector) Collect(ch chan<- prometheus.Metric) {
+	type counts struct{ sources, replicas, stale int }
+	for _, r := range c.w.resources {
+		objects, err := c.w.listObjects(r.Name, labels.Everything())
+		if err != nil {
+			continue
+		}
+		byNamespace := map[string]*counts{}
+		for _, obj := range objects {
+			n, ok := byNamespace[obj.GetNamespace()]
+			if !ok {
+				n = &counts{}
+				byNamespace[obj.GetNamespace()] = n
+			}
+			switch {
+			case HasSyncSourceLabel(obj):
+				n.sources++
+			case IsMirrorverseReplica(obj):
+				n.replicas++
+				if IsMarkedAsStale(obj) {
+					n.stale++
+				}
+			}
+		}
+		for namespace, n := range byNamespace {
+			if n.sources > 0 {
+				ch <- prometheus.MustNewConstMetric(sourcesDesc, prometheus.GaugeValue, float64(n.sources), r.GVK.Kind, namespace)
+			}
+			if n.replicas > 0 {
+				ch <- prometheus.MustNewConstMetric(replicasDesc, prometheus.GaugeValue, float64(n.replicas), r.GVK.Kind, namespace)
+				ch <- prometheus.MustNewConstMetric(staleReplicasDesc, prometheus.GaugeValue, float64(n.stale), r.GVK.Kind, namespace)
+			}
+		}
+	}
+}
+
+// workqueueMetrics exports the metrics of client-go's workqueue (depth, adds, latency,
+// retries...) as mirrorverse_workqueue_*, labelled with the queue name.
+type workqueueMetrics struct{}
+
+var (
+	workqueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mirrorverse_workqueue_depth",
+		Help: "Number of keys waiting in the workqueue.",
+	}, []string{"name"})
+	workqueueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mirrorverse_workqueue_adds_total",
+		Help: "Number of keys added to the workqueue.",
+	}, []string{"name"})
+	workqueueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mirrorverse_workqueue_queue_duration_seconds",
+		Help:    "How long a key waits in the workqueue before a worker picks it up.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"name"})
+	workqueueWorkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mirrorverse_workqueue_work_duration_seconds",
+		Help:    "How long processing a key takes.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"name"})
+	workqueueUnfinished = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mirrorverse_workqueue_unfinished_work_seconds",
+		Help: "Seconds of work in progress that has not been observed by work_duration yet. Growing values mean stuck workers.",
+	}, []string{"name"})
+	workqueueLongestRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mirrorverse_workqueue_longest_running_processor_seconds",
+		Help: "How long the longest running worker has been processing its key.",
+	}, []string{"name"})
+	workqueueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mirrorverse_workqueue_retries_total",
+		Help: "Number of keys put back with backoff after a failed reconcile.",
+	}, []string{"name"})
+)
+
+func init() {
+	prometheus.MustRegister(workqueueDepth, workqueueAdds, workqueueLatency, workqueueWorkDuration,
+		workqueueUnfinished, workqueueLongestRunning, workqueueRetries)
+}
+
+func (workqueueMetrics) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetrics) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetrics) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workqueueLatency.WithLabelValues(name)
+}
+
+func (workqueueMetrics) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueMetrics) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueUnfinished.WithLabelValues(name)
+}
+
+func (workqueueMetrics) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueLongestRunning.WithLabelValues(name)
+}
+
+func (workqueueMetrics) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
@@ -0,0 +1,565 @@
+// MirrorPolicy and ClusterMirrorPolicy: declaring a source and its settings in a custom resource instead of labels
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// MirrorPolicyGVR is the resource of the MirrorPolicy CRD shipped with the chart.
+var MirrorPolicyGVR = schema.GroupVersionResource{Group: "mirrorverse.dev", Version: "v1alpha1", Resource: "mirrorpolicies"}
+
+// ClusterMirrorPolicyGVR is the resource of the ClusterMirrorPolicy CRD shipped with the chart.
+var ClusterMirrorPolicyGVR = schema.GroupVersionResource{Group: "mirrorverse.dev", Version: "v1alpha1", Resource: "clustermirrorpolicies"}
+
+// Resources of queue keys pointing to a MirrorPolicy or a ClusterMirrorPolicy.
+// Keys of a ClusterMirrorPolicy have no namespace.
+const (
+	policyResource        = "mirrorpolicies.mirrorverse.dev"
+	clusterPolicyResource = "clustermirrorpolicies.mirrorverse.dev"
+)
+
+// policySourceIndex indexes policies by the source they reference, see policySourceKey.
+const policySourceIndex = "source"
+
+// MirrorPolicySpec is what a MirrorPolicy or ClusterMirrorPolicy declares. Every field
+// maps to a mirrorverse.dev/* setting of the source, and a field that is set replaces the
+// source's own setting. A ClusterMirrorPolicy replaces the whole target set, see applyPolicy.
+//
+//	apiVersion: mirrorverse.dev/v1alpha1
+//	kind: MirrorPolicy
+//	metadata:
+//	  name: app-config
+//	  namespace: platform
+//	spec:
+//	  source:
+//	    kind: ConfigMap
+//	    name: app-config
+//	  targets: ["staging", "tenant-*"]
+//	  namespaceSelector:
+//	    matchLabels:
+//	      team: payments
+//	  strategy: merge3
+//	  cleanup: true
+type MirrorPolicySpec struct {
+	// Source is mirrored from the policy's own namespace: a MirrorPolicy cannot publish
+	// objects of a namespace its author does not control. A ClusterMirrorPolicy names
+	// the namespace of its source.
+	Source            PolicySource          `json:"source"`
+	Targets           []string              `json:"targets,omitempty"`           // mirrorverse.dev/targets
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"` // mirrorverse.dev/target-selector
+	Exclude           []string              `json:"exclude,omitempty"`           // mirrorverse.dev/exclude
+	Strategy          string                `json:"strategy,omitempty"`          // mirrorverse.dev/strategy
+	Cleanup           *bool                 `json:"cleanup,omitempty"`           // mirrorverse.dev/cleanup
+	ForceConflicts    *bool                 `json:"forceConflicts,omitempty"`    // mirrorverse.dev/force-conflicts
+	Adopt             *bool                 `json:"adopt,omitempty"`             // mirrorverse.dev/adopt
+}
+
+// PolicySource names the source of a policy, e.g. {Kind: "Secret", Name: "registry-creds"}.
+// Kind must be one of the mirrored resources (see --resources).
+type PolicySource struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"` // ClusterMirrorPolicy only
+}
+
+// MirrorPolicyStatus is written by the controller.
+type MirrorPolicyStatus struct {
+	// ObservedGeneration is the generation of the spec the status describes.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions are Ready (every target is synced) and Degraded (something is wrong).
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Targets is the outcome of the last sync, per target namespace.
+	Targets []TargetStatus `json:"targets,omitempty"`
+}
+
+// Condition types and reasons of a policy. Synced, SyncFailed and Refused are shared
+// with the Event reasons (see events.go).
+const (
+	ConditionReady    = "Ready"
+	ConditionDegraded = "Degraded"
+
+	ReasonInvalidSpec     = "InvalidSpec"
+	ReasonUnsupportedKind = "UnsupportedKind"
+	ReasonSourceNotFound  = "SourceNotFound"
+	ReasonSuperseded      = "Superseded"
+)
+
+// policyCRDInstalled reports whether a policy CRD is served by the cluster.
+func policyCRDInstalled(clientset kubernetes.Interface, gvr schema.GroupVersionResource) bool {
+	resources, err := clientset.Discovery().ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return false
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == gvr.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePolicy reads the spec of a MirrorPolicy and checks what the CRD schema cannot.
+func parsePolicy(policy *unstructured.Unstructured) (*MirrorPolicySpec, error) {
+	spec := &MirrorPolicySpec{}
+	raw, _, _ := unstructured.NestedMap(policy.Object, "spec")
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, spec); err != nil {
+		return nil, err
+	}
+	if spec.Source.Kind == "" || spec.Source.Name == "" {
+		return nil, fmt.Errorf("spec.source needs a kind and a name")
+	}
+	if isClusterPolicy(policy) && spec.Source.Namespace == "" {
+		return nil, fmt.Errorf("spec.source needs a namespace")
+	}
+	if spec.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(spec.NamespaceSelector); err != nil {
+			return nil, fmt.Errorf("spec.namespaceSelector: %w", err)
+		}
+	}
+	switch spec.Strategy {
+	case "", StrategyReplace, StrategyPatch, StrategyMerge3, StrategyApply:
+	default:
+		return nil, fmt.Errorf("spec.strategy: unknown strategy '%s'", spec.Strategy)
+	}
+	return spec, nil
+}
+
+// isClusterPolicy reports whether policy is a ClusterMirrorPolicy rather than a MirrorPolicy.
+func isClusterPolicy(policy *unstructured.Unstructured) bool {
+	return policy.GetNamespace() == ""
+}
+
+// policyKind returns "MirrorPolicy" or "ClusterMirrorPolicy", for messages.
+func policyKind(policy *unstructured.Unstructured) string {
+	if isClusterPolicy(policy) {
+		return "ClusterMirrorPolicy"
+	}
+	return "MirrorPolicy"
+}
+
+// policyRef names a policy in messages, e.g. "MirrorPolicy platform/app-config".
+func policyRef(policy *unstructured.Unstructured) string {
+	if isClusterPolicy(policy) {
+		return policyKind(policy) + " " + policy.GetName()
+	}
+	return fmt.Sprintf("%s %s/%s", policyKind(policy), policy.GetNamespace(), policy.GetName())
+}
+
+// policySourceNamespace returns the namespace of a policy's source.
+func policySourceNamespace(policy *unstructured.Unstructured) string {
+	if isClusterPolicy(policy) {
+		namespace, _, _ := unstructured.NestedString(policy.Object, "spec", "source", "namespace")
+		return namespace
+	}
+	return policy.GetNamespace()
+}
+
+// policyKey returns the queue key of a policy.
+func policyKey(policy *unstructured.Unstructured) resourceKey {
+	if isClusterPolicy(policy) {
+		return resourceKey{Resource: clusterPolicyResource, Name: policy.GetName()}
+	}
+	return resourceKey{Resource: policyResource, Namespace: policy.GetNamespace(), Name: policy.GetName()}
+}
+
+// policyInformers returns the informers of the installed policy CRDs, cluster-scoped first.
+func (w *Watcher) policyInformers() []cache.SharedIndexInformer {
+	var informers []cache.SharedIndexInformer
+	for _, informer := range []cache.SharedIndexInformer{w.clusterPolicyInformer, w.policyInformer} {
+		if informer != nil {
+			informers = append(informers, informer)
+		}
+	}
+	return informers
+}
+
+// policySourceKey is the policySourceIndex key of a source, e.g. "ConfigMap/platform/app-config".
+func policySourceKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// indexPolicyBySource is the policySourceIndex function.
+func indexPolicyBySource(obj interface{}) ([]string, error) {
+	policy, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+	kind, _, _ := unstructured.NestedString(policy.Object, "spec", "source", "kind")
+	name, _, _ := unstructured.NestedString(policy.Object, "spec", "source", "name")
+	if kind == "" || name == "" {
+		return nil, nil
+	}
+	return []string{policySourceKey(kind, policySourceNamespace(policy), name)}, nil
+}
+
+// activePolicy returns the policy in charge of a source, or nil if there is none.
+//
+// Conflicts are resolved in this order:
+//   - a ClusterMirrorPolicy wins over any MirrorPolicy: the platform team decides
+//   - among policies of the same scope the oldest one wins, so adding a policy never
+//     takes a source away from another one
+//
+// The policies that lose report Superseded.
+func (w *Watcher) activePolicy(kind, namespace, name string) *unstructured.Unstructured {
+	for _, informer := range w.policyInformers() {
+		if policy := oldestPolicy(informer, policySourceKey(kind, namespace, name)); policy != nil {
+			return policy
+		}
+	}
+	return nil
+}
+
+// oldestPolicy returns the oldest policy of an informer referencing a source, or nil.
+func oldestPolicy(informer cache.SharedIndexInformer, sourceKey string) *unstructured.Unstructured {
+	items, err := informer.GetIndexer().ByIndex(policySourceIndex, sourceKey)
+	if err != nil || len(items) == 0 {
+		return nil
+	}
+	policies := make([]*unstructured.Unstructured, 0, len(items))
+	for _, item := range items {
+		if policy, ok := item.(*unstructured.Unstructured); ok && policy.GetDeletionTimestamp() == nil {
+			policies = append(policies, policy)
+		}
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		ti, tj := policies[i].GetCreationTimestamp(), policies[j].GetCreationTimestamp()
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return policies[i].GetName() < policies[j].GetName()
+	})
+	return policies[0]
+}
+
+// withPolicy returns obj as Mirrorverse sees it: if a MirrorPolicy is in charge of it,
+// a copy carrying the policy's settings as mirrorverse.dev/* labels and annotations, so
+// the rest of the controller handles it like any labelled source. Otherwise obj itself.
+// The copy is never written back: policy settings stay in the policy.
+func (w *Watcher) withPolicy(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	policy := w.activePolicy(obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	if policy == nil {
+		return obj
+	}
+	spec, err := parsePolicy(policy)
+	if err != nil {
+		return obj // reported in the policy's status
+	}
+	return applyPolicy(obj, spec, isClusterPolicy(policy))
+}
+
+// targetKeys are the settings that make up the target set of a source.
+var targetKeys = []string{TargetsAnnotation, TargetSelectorAnnotation, ExcludeAnnotation}
+
+// applyPolicy returns a copy of obj with the settings of spec. With replaceTargets
+// (a ClusterMirrorPolicy) the source's own targets, target-selector and exclude are
+// dropped first, so the policy alone decides where the source goes.
+func applyPolicy(obj *unstructured.Unstructured, spec *MirrorPolicySpec, replaceTargets bool) *unstructured.Unstructured {
+	obj = obj.DeepCopy()
+	objLabels := obj.GetLabels()
+	if objLabels == nil {
+		objLabels = map[string]string{}
+	}
+	objLabels["mirrorverse.dev/sync-source"] = "true"
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if replaceTargets {
+		for _, key := range targetKeys {
+			delete(annotations, key)
+			delete(objLabels, key) // deprecated labels
+		}
+	}
+	obj.SetLabels(objLabels)
+	if len(spec.Targets) > 0 {
+		annotations[TargetsAnnotation] = jsonList(spec.Targets)
+	}
+	if len(spec.Exclude) > 0 {
+		annotations[ExcludeAnnotation] = jsonList(spec.Exclude)
+	}
+	if spec.NamespaceSelector != nil {
+		selector, _ := metav1.LabelSelectorAsSelector(spec.NamespaceSelector) // validated by parsePolicy
+		annotations[TargetSelectorAnnotation] = selector.String()
+	}
+	if spec.Strategy != "" {
+		annotations[StrategyAnnotation] = spec.Strategy
+	}
+	for key, value := range map[string]*bool{CleanupAnnotation: spec.Cleanup, ForceConflictsAnnotation: spec.ForceConflicts, AdoptAnnotation: spec.Adopt} {
+		if value != nil {
+			annotations[key] = strconv.FormatBool(*value)
+		}
+	}
+	obj.SetAnnotations(annotations)
+	return obj
+}
+
+// jsonList renders a list the way GetConfigList reads it back.
+func jsonList(items []string) string {
+	out, _ := json.Marshal(items)
+	return string(out)
+}
+
+// resourceForKind returns the mirrored resource of a kind, e.g. "secrets" for "Secret".
+func (w *Watcher) resourceForKind(kind string) (string, bool) {
+	for _, r := range w.resources {
+		if r.GVK.Kind == kind {
+			return r.Name, true
+		}
+	}
+	return "", false
+}
+
+// policySourceKeyFor returns the queue key of the source a policy references, if it is mirrored.
+func (w *Watcher) policySourceKeyFor(policy *unstructured.Unstructured) (resourceKey, bool) {
+	kind, _, _ := unstructured.NestedString(policy.Object, "spec", "source", "kind")
+	name, _, _ := unstructured.NestedString(policy.Object, "spec", "source", "name")
+	resource, ok := w.resourceForKind(kind)
+	if !ok || name == "" {
+		return resourceKey{}, false
+	}
+	return resourceKey{Resource: resource, Namespace: policySourceNamespace(policy), Name: name}, true
+}
+
+// enqueueSourceOf enqueues the source a policy references, and every policy referencing
+// that source: which one is in charge may have changed.
+func (w *Watcher) enqueueSourceOf(policy *unstructured.Unstructured) {
+	if key, ok := w.policySourceKeyFor(policy); ok {
+		w.queue.Add(key)
+		w.enqueuePolicies(w.kindOfResource(key.Resource), key)
+	}
+}
+
+// policyEventHandler enqueues a policy when its spec changes, and the sources it
+// referenced so they pick up (or drop) its settings. Status writes only bump the
+// resourceVersion, not the generation, so they do not come back as work.
+// It serves both MirrorPolicies and ClusterMirrorPolicies.
+func (w *Watcher) policyEventHandler() cache.ResourceEventHandlerFuncs {
+	enqueue := func(policy *unstructured.Unstructured) {
+		w.queue.Add(policyKey(policy))
+		w.enqueueSourceOf(policy)
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if policy, ok := obj.(*unstructured.Unstructured); ok {
+				enqueue(policy)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPolicy, ok := oldObj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			newPolicy, ok := newObj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			if oldPolicy.GetGeneration() == newPolicy.GetGeneration() {
+				return
+			}
+			// The old source is released if the policy now points somewhere else
+			w.enqueueSourceOf(oldPolicy)
+			enqueue(newPolicy)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if policy, ok := obj.(*unstructured.Unstructured); ok {
+				w.enqueueSourceOf(policy)
+			}
+		},
+	}
+}
+
+// reconcilePolicy reports the problems that keep a policy from syncing anything:
+// an invalid spec, a kind that is not mirrored, a missing source, or another policy
+// already in charge of the source. Otherwise the source is enqueued, and its reconcile
+// writes the per-target status (see updatePolicyStatus).
+func (w *Watcher) reconcilePolicy(ctx context.Context, key resourceKey) error {
+	informer, storeKey := w.policyInformer, key.Namespace+"/"+key.Name
+	if key.Resource == clusterPolicyResource {
+		informer, storeKey = w.clusterPolicyInformer, key.Name
+	}
+	if informer == nil {
+		return nil
+	}
+	cached, exists, err := informer.GetIndexer().GetByKey(storeKey)
+	if err != nil || !exists {
+		return err
+	}
+	policy, ok := cached.(*unstructured.Unstructured)
+	if !ok || policy.GetDeletionTimestamp() != nil {
+		return nil // deleted, its source was enqueued by the event handler
+	}
+	spec, err := parsePolicy(policy)
+	if err != nil {
+		return w.setPolicyProblem(ctx, policy, ReasonInvalidSpec, err.Error())
+	}
+	resource, ok := w.resourceForKind(spec.Source.Kind)
+	if !ok {
+		return w.setPolicyProblem(ctx, policy, ReasonUnsupportedKind,
+			fmt.Sprintf("%s is not mirrored, the controller watches %v", spec.Source.Kind, w.resourceNames()))
+	}
+	namespace := policySourceNamespace(policy)
+	if !w.rbacSourceAllowed(w.groupKindOfResource(resource), namespace, isClusterPolicy(policy)) {
+		return w.setPolicyProblem(ctx, policy, ReasonRefused, rbacRefusal)
+	}
+	if active := w.activePolicy(spec.Source.Kind, namespace, spec.Source.Name); active != nil && active.GetUID() != policy.GetUID() {
+		return w.setPolicyProblem(ctx, policy, ReasonSuperseded,
+			fmt.Sprintf("%s already mirrors %s %s/%s", policyRef(active), spec.Source.Kind, namespace, spec.Source.Name))
+	}
+	sourceKey := resourceKey{Resource: resource, Namespace: namespace, Name: spec.Source.Name}
+	if _, err := w.getObject(sourceKey); apierrors.IsNotFound(err) {
+		return w.setPolicyProblem(ctx, policy, ReasonSourceNotFound,
+			fmt.Sprintf("%s %s not found in namespace %s", spec.Source.Kind, spec.Source.Name, namespace))
+	} else if err != nil {
+		return err
+	}
+	w.queue.Add(sourceKey)
+	return nil
+}
+
+// enqueuePolicies enqueues the policies referencing a source, e.g. after it was deleted.
+func (w *Watcher) enqueuePolicies(kind string, key resourceKey) {
+	for _, informer := range w.policyInformers() {
+		items, err := informer.GetIndexer().ByIndex(policySourceIndex, policySourceKey(kind, key.Namespace, key.Name))
+		if err != nil {
+			continue
+		}
+		for _, item := range items {
+			if policy, ok := item.(*unstructured.Unstructured); ok {
+				w.queue.Add(policyKey(policy))
+			}
+		}
+	}
+}
+
+// kindOfResource returns the kind of a mirrored resource, e.g. "Secret" for "secrets".
+func (w *Watcher) kindOfResource(resource string) string {
+	for _, r := range w.resources {
+		if r.Name == resource {
+			return r.GVK.Kind
+		}
+	}
+	return ""
+}
+
+// updatePolicyStatus records the outcome of syncing a source on the policy in charge of it, if any.
+func (w *Watcher) updatePolicyStatus(ctx context.Context, source *unstructured.Unstructured, results []TargetStatus) error {
+	policy := w.activePolicy(source.GetKind(), source.GetNamespace(), source.GetName())
+	if policy == nil {
+		return nil
+	}
+	var failed []string
+	for _, r := range results {
+		if r.State != TargetSynced {
+			failed = append(failed, fmt.Sprintf("%s (%s)", r.Namespace, r.State))
+		}
+	}
+	reason, message := ReasonSynced, fmt.Sprintf("%d target namespaces synced", len(results))
+	if len(failed) > 0 {
+		reason, message = ReasonSyncFailed, fmt.Sprintf("%d of %d target namespaces not synced: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	err := w.writePolicyStatus(ctx, policy, func(status *MirrorPolicyStatus) {
+		// A policy's lastSyncTime only moves when a target's state changes: writing the
+		// status on every sync would trigger a watch event on every resync
+		status.Targets = keepSettledTimes(mergeTargetTimes(results, status.Targets), status.Targets)
+		setPolicyConditions(status, policy.GetGeneration(), len(failed) == 0, reason, message)
+	})
+	// A healthy source is not reconciled again until something changes, so retry through
+	// the policy: reconciling it enqueues the source, which writes the status again.
+	// The policy key is forgotten by the queue once reconciled, so it keeps its own backoff.
+	key := policyKey(policy)
+	if err != nil {
+		w.queue.AddAfter(key, w.policyStatusRetries.When(key))
+		return err
+	}
+	w.policyStatusRetries.Forget(key)
+	return nil
+}
+
+// setPolicyProblem marks a policy as not Ready and Degraded, and clears its targets.
+func (w *Watcher) setPolicyProblem(ctx context.Context, policy *unstructured.Unstructured, reason, message string) error {
+	fmt.Printf("%s: %s\n", policyRef(policy), message)
+	return w.writePolicyStatus(ctx, policy, func(status *MirrorPolicyStatus) {
+		status.Targets = nil
+		setPolicyConditions(status, policy.GetGeneration(), false, reason, message)
+	})
+}
+
+// setPolicyConditions sets Ready and Degraded, which are always opposite.
+func setPolicyConditions(status *MirrorPolicyStatus, generation int64, ready bool, reason, message string) {
+	readyStatus, degradedStatus := metav1.ConditionTrue, metav1.ConditionFalse
+	if !ready {
+		readyStatus, degradedStatus = metav1.ConditionFalse, metav1.ConditionTrue
+	}
+	status.ObservedGeneration = generation
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: ConditionReady, Status: readyStatus, ObservedGeneration: generation, Reason: reason, Message: message})
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: ConditionDegraded, Status: degradedStatus, ObservedGeneration: generation, Reason: reason, Message: message})
+}
+
+// writePolicyStatus applies update to the status of a policy and writes it through the
+// status subresource, unless nothing changed: a status write triggers a watch event,
+// so writing unconditionally would be wasteful on every resync.
+// The status is merge patched, so a policy cache that is a little behind does not fail
+// the write with a conflict.
+func (w *Watcher) writePolicyStatus(ctx context.Context, cached *unstructured.Unstructured, update func(status *MirrorPolicyStatus)) error {
+	policy := cached.DeepCopy()
+	status := &MirrorPolicyStatus{}
+	if raw, ok, _ := unstructured.NestedMap(policy.Object, "status"); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, status); err != nil {
+			fmt.Printf("Ignoring unreadable status of %s: %v\n", policyRef(policy), err)
+			status = &MirrorPolicyStatus{}
+		}
+	}
+	update(status)
+	raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(status)
+	if err != nil {
+		return err
+	}
+	if old, _, _ := unstructured.NestedMap(policy.Object, "status"); equality.Semantic.DeepEqual(old, raw) {
+		return nil
+	}
+	// A merge patch only changes what it mentions: targets is left out of raw when
+	// empty (omitempty), so it must be deleted explicitly
+	patched := map[string]interface{}{}
+	for k, v := range raw {
+		patched[k] = v
+	}
+	if _, ok := patched["targets"]; !ok {
+		patched["targets"] = nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{"status": patched})
+	if err != nil {
+		return err
+	}
+	if isClusterPolicy(policy) {
+		_, err = w.dynamicClient.Resource(ClusterMirrorPolicyGVR).Patch(ctx, policy.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	} else {
+		_, err = w.dynamicClient.Resource(MirrorPolicyGVR).Namespace(policy.GetNamespace()).Patch(ctx, policy.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	}
+	if err != nil {
+		fmt.Printf("Failed to update status of %s: %v\n", policyRef(policy), err)
+	}
+	return err
+}
@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestApplyPolicy(t *testing.T) {
+	yes := true
+	tests := []struct {
+		name           string
+		labels         map[string]string
+		annotations    map[string]string
+		spec           MirrorPolicySpec
+		replaceTargets bool
+		wantLabels     map[string]string
+		wantAnnotation map[string]string
+	}{
+		{
+			name: "settings become annotations",
+			spec: MirrorPolicySpec{
+				Targets:  []string{"staging", "tenant-*"},
+				Exclude:  []string{"tenant-b"},
+				Strategy: StrategyMerge3,
+				Cleanup:  &yes,
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"team": "payments"},
+				},
+			},
+			wantLabels: map[string]string{"mirrorverse.dev/sync-source": "true"},
+			wantAnnotation: map[string]string{
+				TargetsAnnotation:        `["staging","tenant-*"]`,
+				ExcludeAnnotation:        `["tenant-b"]`,
+				TargetSelectorAnnotation: "team=payments",
+				StrategyAnnotation:       StrategyMerge3,
+				CleanupAnnotation:        "true",
+			},
+		},
+		{
+			name:        "a MirrorPolicy overrides the settings it sets and keeps the others",
+			annotations: map[string]string{TargetsAnnotation: "prod", TargetSelectorAnnotation: "tier=web", StrategyAnnotation: StrategyPatch},
+			spec:        MirrorPolicySpec{Targets: []string{"staging"}},
+			wantLabels:  map[string]string{"mirrorverse.dev/sync-source": "true"},
+			wantAnnotation: map[string]string{
+				TargetsAnnotation:        `["staging"]`,
+				TargetSelectorAnnotation: "tier=web",
+				StrategyAnnotation:       StrategyPatch,
+			},
+		},
+		{
+			name:           "a ClusterMirrorPolicy replaces targets, target-selector and exclude",
+			annotations:    map[string]string{TargetSelectorAnnotation: "tier=web", ExcludeAnnotation: "prod", StrategyAnnotation: StrategyPatch},
+			spec:           MirrorPolicySpec{Targets: []string{"staging"}},
+			replaceTargets: true,
+			wantLabels:     map[string]string{"mirrorverse.dev/sync-source": "true"},
+			wantAnnotation: map[string]string{
+				TargetsAnnotation:  `["staging"]`,
+				StrategyAnnotation: StrategyPatch,
+			},
+		},
+		{
+			name:           "a ClusterMirrorPolicy also drops deprecated target labels",
+			labels:         map[string]string{TargetsAnnotation: "prod_dev", ExcludeAnnotation: "dev", "team": "a"},
+			spec:           MirrorPolicySpec{Targets: []string{"staging"}},
+			replaceTargets: true,
+			wantLabels:     map[string]string{"mirrorverse.dev/sync-source": "true", "team": "a"},
+			wantAnnotation: map[string]string{TargetsAnnotation: `["staging"]`},
+		},
+		{
+			name:           "deprecated target labels stay under a MirrorPolicy",
+			labels:         map[string]string{ExcludeAnnotation: "dev"},
+			spec:           MirrorPolicySpec{Targets: []string{"staging"}},
+			wantLabels:     map[string]string{"mirrorverse.dev/sync-source": "true", ExcludeAnnotation: "dev"},
+			wantAnnotation: map[string]string{TargetsAnnotation: `["staging"]`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := configMap("platform", "app", tt.labels, tt.annotations, nil)
+			original := obj.DeepCopy()
+			got := applyPolicy(obj, &tt.spec, tt.replaceTargets)
+			if !reflect.DeepEqual(got.GetLabels(), tt.wantLabels) {
+				t.Errorf("labels = %v, want %v", got.GetLabels(), tt.wantLabels)
+			}
+			if !reflect.DeepEqual(got.GetAnnotations(), tt.wantAnnotation) {
+				t.Errorf("annotations = %v, want %v", got.GetAnnotations(), tt.wantAnnotation)
+			}
+			if !reflect.DeepEqual(obj, original) {
+				t.Errorf("applyPolicy modified its input")
+			}
+		})
+	}
+}
+
+// testPolicy returns a MirrorPolicy, or a ClusterMirrorPolicy if namespace is empty,
+// for ConfigMap platform/app.
+func testPolicy(namespace, name string, created time.Time, targets ...string) *unstructured.Unstructured {
+	source := map[string]interface{}{"kind": "ConfigMap", "name": "app"}
+	if namespace == "" {
+		source["namespace"] = "platform"
+	}
+	list := make([]interface{}, len(targets))
+	for i, target := range targets {
+		list[i] = target
+	}
+	policy := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "mirrorverse.dev/v1alpha1",
+		"kind":       "MirrorPolicy",
+		"spec":       map[string]interface{}{"source": source, "targets": list},
+	}}
+	if namespace == "" {
+		policy.SetKind("ClusterMirrorPolicy")
+	}
+	policy.SetNamespace(namespace)
+	policy.SetName(name)
+	policy.SetCreationTimestamp(metav1.NewTime(created))
+	return policy
+}
+
+func policyIndexer(t *testing.T, policies ...*unstructured.Unstructured) cache.SharedIndexInformer {
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &unstructured.Unstructured{}, 0,
+		cache.Indexers{policySourceIndex: indexPolicyBySource})
+	for _, policy := range policies {
+		if err := informer.GetIndexer().Add(policy); err != nil {
+			t.Fatalf("adding %s: %v", policy.GetName(), err)
+		}
+	}
+	return informer
+}
+
+func TestActivePolicy(t *testing.T) {
+	older := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	deleted := testPolicy("platform", "deleted", older.Add(-time.Hour), "dev")
+	deleted.SetDeletionTimestamp(&metav1.Time{Time: newer})
+
+	tests := []struct {
+		name     string
+		cluster  []*unstructured.Unstructured
+		policies []*unstructured.Unstructured
+		want     string // name of the active policy, empty for none
+	}{
+		{name: "no policy"},
+		{
+			name:     "a MirrorPolicy",
+			policies: []*unstructured.Unstructured{testPolicy("platform", "team", older, "staging")},
+			want:     "team",
+		},
+		{
+			name:     "a ClusterMirrorPolicy wins over an older MirrorPolicy",
+			cluster:  []*unstructured.Unstructured{testPolicy("", "platform", newer, "prod")},
+			policies: []*unstructured.Unstructured{testPolicy("platform", "team", older, "staging")},
+			want:     "platform",
+		},
+		{
+			name: "the oldest policy wins",
+			policies: []*unstructured.Unstructured{
+				testPolicy("platform", "b-newer", newer, "prod"),
+				testPolicy("platform", "a-older", older, "staging"),
+			},
+			want: "a-older",
+		},
+		{
+			name: "the name breaks a tie",
+			policies: []*unstructured.Unstructured{
+				testPolicy("platform", "b", older, "prod"),
+				testPolicy("platform", "a", older, "staging"),
+			},
+			want: "a",
+		},
+		{
+			name: "the oldest ClusterMirrorPolicy wins",
+			cluster: []*unstructured.Unstructured{
+				testPolicy("", "b-older", older, "prod"),
+				testPolicy("", "a-newer", newer, "staging"),
+			},
+			want: "b-older",
+		},
+		{
+			name:     "policies being deleted are ignored",
+			policies: []*unstructured.Unstructured{deleted, testPolicy("platform", "team", older, "staging")},
+			want:     "team",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Watcher{
+				clusterPolicyInformer: policyIndexer(t, tt.cluster...),
+				policyInformer:        policyIndexer(t, tt.policies...),
+			}
+			got := w.activePolicy("ConfigMap", "platform", "app")
+			switch {
+			case got == nil && tt.want != "":
+				t.Errorf("activePolicy = nil, want %s", tt.want)
+			case got != nil && got.GetName() != tt.want:
+				t.Errorf("activePolicy = %s, want %q", got.GetName(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := configMap("platform", "app", nil, map[string]string{TargetsAnnotation: "dev", TargetSelectorAnnotation: "tier=web"}, nil)
+
+	tests := []struct {
+		name         string
+		cluster      []*unstructured.Unstructured
+		policies     []*unstructured.Unstructured
+		wantTargets  string
+		wantSelector string
+	}{
+		{
+			name:         "annotations without a policy",
+			wantTargets:  "dev",
+			wantSelector: "tier=web",
+		},
+		{
+			name:         "a MirrorPolicy overrides the annotations",
+			policies:     []*unstructured.Unstructured{testPolicy("platform", "team", created, "staging")},
+			wantTargets:  `["staging"]`,
+			wantSelector: "tier=web",
+		},
+		{
+			name:        "a ClusterMirrorPolicy replaces the targets of both",
+			cluster:     []*unstructured.Unstructured{testPolicy("", "platform", created, "prod")},
+			policies:    []*unstructured.Unstructured{testPolicy("platform", "team", created, "staging")},
+			wantTargets: `["prod"]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Watcher{
+				clusterPolicyInformer: policyIndexer(t, tt.cluster...),
+				policyInformer:        policyIndexer(t, tt.policies...),
+			}
+			got := w.withPolicy(source).GetAnnotations()
+			if got[TargetsAnnotation] != tt.wantTargets || got[TargetSelectorAnnotation] != tt.wantSelector {
+				t.Errorf("targets = %q, selector = %q, want %q and %q",
+					got[TargetsAnnotation], got[TargetSelectorAnnotation], tt.wantTargets, tt.wantSelector)
+			}
+		})
+	}
+}
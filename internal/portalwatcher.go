@@ -3,15 +3,29 @@ package internal
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/watch"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
 // =====================
-// Mirrorverse Watcher: Watches for changes to ConfigMaps and Secrets in all namespaces.
+// Mirrorverse Watcher: Watches for changes to the configured resources (ConfigMaps and
+// Secrets by default) in all namespaces.
 // This is the "event loop" that powers the whole controller.
 //
 // If you're new to Kubernetes controllers, see:
@@ -20,121 +34,577 @@ import (
 //   - https://book.kubebuilder.io/cronjob-tutorial/controller-implementation.html
 // =====================
 
+// resourceKey identifies one object in the workqueue.
+//
+// For beginners: the queue stores keys, not objects. When the same object changes
+// five times before a worker gets to it, the five events collapse into a single key,
+// and the worker always reads the latest version from the informer cache.
+type resourceKey struct {
+	Resource  string // e.g. "configmaps", "secrets" or "networkpolicies.networking.k8s.io"
+	Namespace string
+	Name      string
+}
+
+func (k resourceKey) String() string {
+	return fmt.Sprintf("%s %s/%s", k.Resource, k.Namespace, k.Name)
+}
+
+// WatcherOptions tunes the controller; zero values fall back to sensible defaults.
+type WatcherOptions struct {
+	// Workers is the number of keys reconciled in parallel.
+	Workers int
+	// ResyncInterval is how often the full reconciler pass runs. Zero disables it.
+	ResyncInterval time.Duration
+	// ReconcileTimeout bounds the API calls made while reconciling a single key.
+	ReconcileTimeout time.Duration
+	// ShutdownTimeout is how long in-flight reconciles may run after shutdown starts.
+	ShutdownTimeout time.Duration
+	// Resources lists the namespaced resources to mirror, as "resource" or "resource.group".
+	// Empty means DefaultResources.
+	Resources []string
+	// RBACSourceNamespaces lists the namespaces Roles and RoleBindings may be mirrored from
+	// without a ClusterMirrorPolicy (see rbacSourceAllowed).
+	RBACSourceNamespaces []string
+}
+
+// Watcher holds the informers, the local caches (listers) and the workqueue.
+//
+// For beginners: an informer lists every object once, then keeps a watch open and
+// updates a local cache. If the watch drops, the informer re-lists and replays what
+// it missed, so no event is lost and a restart always catches up.
+//
+// Mirrored resources are read and written through the dynamic client as
+// unstructured objects, so any namespaced kind works the same way; only
+// Namespaces use the typed client.
+type Watcher struct {
+	clientset       *kubernetes.Clientset
+	dynamicClient   dynamic.Interface
+	recorder        record.EventRecorder
+	informerFactory informers.SharedInformerFactory
+	dynamicFactory  dynamicinformer.DynamicSharedInformerFactory
+	resources       []Resource
+	listers         map[string]cache.GenericLister
+	// nil when the MirrorPolicy or ClusterMirrorPolicy CRD is not installed
+	policyInformer        cache.SharedIndexInformer
+	clusterPolicyInformer cache.SharedIndexInformer
+	namespaceLister       corelisters.NamespaceLister
+	namespacesSynced      cache.InformerSynced
+	rbacSourceNamespaces  []string
+	queue                 workqueue.RateLimitingInterface
+	// backoff of policy status writes that failed, see updatePolicyStatus
+	policyStatusRetries workqueue.RateLimiter
+	workers             int
+	resyncInterval      time.Duration
+	reconcileTimeout    time.Duration
+	shutdownTimeout     time.Duration
+
+	// sources remembers what was last seen and done for every sync source
+	sourcesMu sync.Mutex
+	sources   map[resourceKey]*sourceState
+}
+
+// sourceState is what the watcher remembers about a source between reconciles.
+type sourceState struct {
+	// obj is the last seen version, so cleanup can still read its labels after it disappeared from the cache
+	obj *unstructured.Unstructured
+	// targets are the namespaces it was synced into last time. Replicas are also found
+	// through the cache (see syncedNamespaces), this covers the ones the cache has not seen yet.
+	targets []string
+}
+
+// NewWatcher wires informers for the configured resources and Namespaces to a rate-limited workqueue.
+// Failed keys are retried with exponential backoff. It fails if a resource is unknown or cluster-scoped.
+func NewWatcher(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, opts WatcherOptions) (*Watcher, error) {
+	names := opts.Resources
+	if len(names) == 0 {
+		names = DefaultResources
+	}
+	resources, err := ResolveResources(clientset, names)
+	if err != nil {
+		return nil, err
+	}
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	reconcileTimeout := opts.ReconcileTimeout
+	if reconcileTimeout <= 0 {
+		reconcileTimeout = 30 * time.Second
+	}
+	shutdownTimeout := opts.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 20 * time.Second
+	}
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	dynamicFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+	w := &Watcher{
+		clientset:            clientset,
+		dynamicClient:        dynamicClient,
+		recorder:             NewEventRecorder(clientset),
+		informerFactory:      factory,
+		dynamicFactory:       dynamicFactory,
+		resources:            resources,
+		listers:              map[string]cache.GenericLister{},
+		namespaceLister:      factory.Core().V1().Namespaces().Lister(),
+		namespacesSynced:     factory.Core().V1().Namespaces().Informer().HasSynced,
+		rbacSourceNamespaces: FilterNamespaces(opts.RBACSourceNamespaces, nil),
+		queue:                workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "mirrorverse"),
+		policyStatusRetries:  workqueue.NewItemExponentialFailureRateLimiter(time.Second, 5*time.Minute),
+		workers:              workers,
+		resyncInterval:       opts.ResyncInterval,
+		reconcileTimeout:     reconcileTimeout,
+		shutdownTimeout:      shutdownTimeout,
+		sources:              map[resourceKey]*sourceState{},
+	}
+	for _, r := range resources {
+		informer := dynamicFactory.ForResource(r.GVR)
+		informer.Informer().AddEventHandler(w.eventHandler(r.Name))
+		w.listers[r.Name] = informer.Lister()
+	}
+	factory.Core().V1().Namespaces().Informer().AddEventHandler(w.namespaceEventHandler())
+	for _, policy := range []struct {
+		gvr      schema.GroupVersionResource
+		informer *cache.SharedIndexInformer
+	}{
+		{MirrorPolicyGVR, &w.policyInformer},
+		{ClusterMirrorPolicyGVR, &w.clusterPolicyInformer},
+	} {
+		if !policyCRDInstalled(clientset, policy.gvr) {
+			fmt.Printf("%s CRD is not installed, ignoring them\n", policy.gvr.GroupResource())
+			continue
+		}
+		informer := dynamicFactory.ForResource(policy.gvr).Informer()
+		if err := informer.AddIndexers(cache.Indexers{policySourceIndex: indexPolicyBySource}); err != nil {
+			return nil, err
+		}
+		informer.AddEventHandler(w.policyEventHandler())
+		*policy.informer = informer
+	}
+	return w, nil
+}
+
+// resourceNames returns the names of the mirrored resources, in configuration order.
+func (w *Watcher) resourceNames() []string {
+	names := make([]string, 0, len(w.resources))
+	for _, r := range w.resources {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// client returns the dynamic client for a mirrored resource.
+func (w *Watcher) client(resource string) dynamic.NamespaceableResourceInterface {
+	for _, r := range w.resources {
+		if r.Name == resource {
+			return w.dynamicClient.Resource(r.GVR)
+		}
+	}
+	// Keys are only ever built from the configured resources
+	panic(fmt.Sprintf("unknown resource: %s", resource))
+}
+
 // CreateWatcher is the entry point for starting the Mirrorverse watcher system.
 //
 // What it does:
-//   - Creates a channel (stopCh) that could be used to signal the watchers to stop (not used here, but good practice for future extensibility).
-//   - Starts two goroutines (background threads in Go):
-//     1. One to watch all ConfigMaps in all namespaces
-//     2. One to watch all Secrets in all namespaces
-//   - Each watcher runs independently and will react to add/update/delete events.
-//   - The final 'select {}' line blocks forever, so the program doesn't exit and the watchers keep running.
-//
-// Why goroutines? In Go, goroutines are lightweight threads. This lets us watch both resource types in parallel without blocking each other.
+//   - Starts one shared informer per mirrored resource (all namespaces),
+//     plus one for Namespaces so label selectors in targets can be resolved.
+//   - Waits until all local caches are filled.
+//   - Starts `workers` goroutines that pull keys off the queue and reconcile them.
+//   - Starts the periodic reconciler loop (see reconciler.go) that repairs anything events missed.
+//   - Blocks until ctx is cancelled, then shuts down gracefully (see Run).
 //
 // For more on goroutines: https://gobyexample.com/goroutines
 // For more on channels:   https://gobyexample.com/channels
-func CreateWatcher(clientset *kubernetes.Clientset) {
-	fmt.Println("Watching ConfigMaps and Secrets...")
-	stopCh := make(chan struct{}) // Channel to signal stopping (not used here, but good practice)
-	// Start a watcher goroutine for each resource type
-	go watchResource(clientset, "configmaps", stopCh)
-	go watchResource(clientset, "secrets", stopCh)
-	select {} // Block forever so the watchers keep running
+// For more on contexts:   https://gobyexample.com/context
+func CreateWatcher(ctx context.Context, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, opts WatcherOptions) error {
+	w, err := NewWatcher(clientset, dynamicClient, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Watching %v...\n", w.resourceNames())
+	return w.Run(ctx)
 }
 
-// watchResource watches a specific resource type (ConfigMap or Secret) and handles events.
-// It will automatically restart itself if the watch channel closes (e.g., due to network issues).
+// Run starts the informers, waits for their caches and launches the workers.
+// It blocks until ctx is cancelled.
 //
-// For beginners: This is a loop that keeps listening for changes (add, update, delete)
-// to a specific resource type. When something happens, it calls handleEvent to react.
-func watchResource(clientset *kubernetes.Clientset, resource string, stopCh <-chan struct{}) {
-	watcher, err := getWatcher(clientset, resource)
-	if err != nil {
-		fmt.Printf("Error creating watcher for %s: %v\n", resource, err)
-		return
+// Shutdown happens in two steps: first the queue stops handing out new keys and the
+// workers finish the reconcile they are in the middle of. Only if that takes longer
+// than ShutdownTimeout are the in-flight API calls cancelled, so a SIGTERM does not
+// cut a write in half.
+func (w *Watcher) Run(ctx context.Context) error {
+	w.informerFactory.Start(ctx.Done())
+	w.dynamicFactory.Start(ctx.Done())
+	for informerType, ok := range w.informerFactory.WaitForCacheSync(ctx.Done()) {
+		if !ok {
+			return fmt.Errorf("failed to sync informer cache for %v", informerType)
+		}
+	}
+	for gvr, ok := range w.dynamicFactory.WaitForCacheSync(ctx.Done()) {
+		if !ok {
+			return fmt.Errorf("failed to sync informer cache for %v", gvr)
+		}
 	}
-	defer watcher.Stop()
 
-	fmt.Printf("Started watching %s...\n", resource)
-	for {
-		select {
-		case event, ok := <-watcher.ResultChan():
+	// Only the leader counts objects: standbys have no caches to count from
+	collector := objectCollector{w: w}
+	if err := prometheus.Register(collector); err != nil {
+		return fmt.Errorf("failed to register object metrics: %w", err)
+	}
+	defer prometheus.Unregister(collector)
+
+	// workCtx outlives ctx on purpose: in-flight reconciles keep it until the drain timeout
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	fmt.Printf("Caches synced, starting %d workers...\n", w.workers)
+	var wg sync.WaitGroup
+	for i := 0; i < w.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w.processNextItem(ctx, workCtx) {
+			}
+		}()
+	}
+	if w.resyncInterval > 0 {
+		fmt.Printf("Running full resync every %s\n", w.resyncInterval)
+		go wait.Until(func() { w.resyncAll(workCtx) }, w.resyncInterval, ctx.Done())
+	}
+
+	<-ctx.Done()
+	fmt.Println("Shutting down, waiting for in-flight reconciles...")
+	w.queue.ShutDown()
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		fmt.Println("All workers stopped")
+	case <-time.After(w.shutdownTimeout):
+		fmt.Printf("In-flight reconciles did not finish within %s, cancelling them\n", w.shutdownTimeout)
+		cancelWork()
+		<-drained
+	}
+	return nil
+}
+
+// eventHandler turns informer callbacks into queue keys for the given resource type.
+//
+// For beginners: the handlers do no work themselves, they only enqueue. All the
+// real logic runs in reconcile, on a worker goroutine.
+func (w *Watcher) eventHandler(resource string) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				w.enqueue(resource, w.withPolicy(u))
+			}
+		},
+		UpdateFunc: func(oldRaw, newRaw interface{}) {
+			oldObj, ok := oldRaw.(*unstructured.Unstructured)
 			if !ok {
-				// If the channel is closed, restart the watcher after a short delay
-				time.Sleep(2 * time.Second)
-				go watchResource(clientset, resource, stopCh)
 				return
 			}
-			handleEvent(event, resource, clientset)
-		case <-stopCh:
-			// If stopCh is closed, exit the watcher
-			return
-		}
+			newObj, ok := newRaw.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			if onlySyncStatusChanged(oldObj, newObj) {
+				return // our own status write
+			}
+			oldObj, newObj = w.withPolicy(oldObj), w.withPolicy(newObj)
+			// A source that lost its sync-source label is no longer a source, but its
+			// replicas still need cleaning up: remember the old version and enqueue anyway
+			if HasSyncSourceLabel(oldObj) && !HasSyncSourceLabel(newObj) {
+				key := keyFor(resource, newObj)
+				if _, ok := w.trackedSource(key); !ok {
+					w.trackSource(key, oldObj)
+				}
+				w.queue.Add(key)
+				return
+			}
+			w.enqueue(resource, newObj)
+		},
+		DeleteFunc: func(raw interface{}) {
+			// A delete can arrive as a tombstone if the watch missed the final state
+			if tombstone, ok := raw.(cache.DeletedFinalStateUnknown); ok {
+				raw = tombstone.Obj
+			}
+			obj, ok := raw.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			obj = w.withPolicy(obj)
+			// A source that went through the finalizer was already cleaned up
+			if HasSyncSourceLabel(obj) && !IsBeingDeleted(obj) {
+				w.trackSource(keyFor(resource, obj), obj)
+			}
+			// A deleted replica is recreated by reconciling its source, unless the
+			// source no longer targets the namespace (see OptOutAnnotation)
+			if IsMirrorverseReplica(obj) && !IsMarkedAsStale(obj) {
+				if name, namespace := GetSyncSourceRef(obj); name != "" {
+					w.queue.Add(resourceKey{Resource: resource, Namespace: namespace, Name: name})
+				}
+			}
+			w.enqueue(resource, obj)
+		},
 	}
 }
 
-// getWatcher returns a Kubernetes watcher for the given resource type (ConfigMap or Secret).
-// It watches all namespaces by passing an empty string as the namespace.
-//
-// For more on how "watch" works in Kubernetes:
-//
-//	https://kubernetes.io/docs/reference/using-api/api-concepts/#efficient-detection-of-changes
-func getWatcher(clientset *kubernetes.Clientset, resource string) (watch.Interface, error) {
-	switch resource {
-	case "configmaps":
-		return clientset.CoreV1().ConfigMaps("").Watch(context.TODO(), metav1.ListOptions{})
-	case "secrets":
-		return clientset.CoreV1().Secrets("").Watch(context.TODO(), metav1.ListOptions{})
-	default:
-		return nil, fmt.Errorf("unknown resource: %s", resource)
+// enqueue adds the key of a source or replica to the queue; other objects are ignored.
+// Objects still holding the cleanup finalizer count as sources until it is removed.
+func (w *Watcher) enqueue(resource string, obj *unstructured.Unstructured) {
+	if !HasSyncSourceLabel(obj) && !IsMirrorverseReplica(obj) && !HasCleanupFinalizer(obj) {
+		return
 	}
+	w.queue.Add(keyFor(resource, obj))
+}
+
+func keyFor(resource string, obj *unstructured.Unstructured) resourceKey {
+	return resourceKey{Resource: resource, Namespace: obj.GetNamespace(), Name: obj.GetName()}
 }
 
-// handleEvent processes a watch event for a resource (ConfigMap or Secret).
-// It determines what kind of event happened (Added, Modified, Deleted, Error)
-// and triggers the appropriate Mirrorverse sync logic.
+// processNextItem takes one key off the queue and reconciles it.
+// On error the key is put back with backoff; on success its backoff is reset.
+// It returns false once ctx is cancelled; keys still queued are left for the next leader.
+func (w *Watcher) processNextItem(ctx, workCtx context.Context) bool {
+	item, shutdown := w.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer w.queue.Done(item)
+	if ctx.Err() != nil {
+		return false
+	}
+
+	key := item.(resourceKey)
+	reconcileCtx, cancel := context.WithTimeout(workCtx, w.reconcileTimeout)
+	defer cancel()
+	start := time.Now()
+	err := w.reconcile(reconcileCtx, key)
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	reconcileDuration.WithLabelValues(key.Resource, result).Observe(time.Since(start).Seconds())
+	if err != nil {
+		fmt.Printf("Error syncing %s (retry %d): %v\n", key, w.queue.NumRequeues(key), err)
+		w.queue.AddRateLimited(key)
+		return true
+	}
+	w.queue.Forget(key)
+	return true
+}
+
+// getObject reads the current version of a key from the informer cache, with the
+// settings of its MirrorPolicy if it has one (see withPolicy).
+func (w *Watcher) getObject(key resourceKey) (*unstructured.Unstructured, error) {
+	lister, ok := w.listers[key.Resource]
+	if !ok {
+		return nil, fmt.Errorf("unknown resource: %s", key.Resource)
+	}
+	cached, err := lister.ByNamespace(key.Namespace).Get(key.Name)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := cached.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object of type %T in %s cache", cached, key.Resource)
+	}
+	return w.withPolicy(obj), nil
+}
+
+// sourceGetter reads sources of a resource type for GetSyncSourceObject.
+func (w *Watcher) sourceGetter(resource string) func(namespace, name string) (*unstructured.Unstructured, error) {
+	return func(namespace, name string) (*unstructured.Unstructured, error) {
+		return w.getObject(resourceKey{Resource: resource, Namespace: namespace, Name: name})
+	}
+}
+
+// reconcile brings the world in line with one mirrored object.
+// It determines what kind of object the key points to and triggers the
+// appropriate Mirrorverse sync logic.
 //
 // For beginners: This is the "brain" that decides what to do when something changes.
-// If a new source is created, it triggers sync. If a replica is updated, it checks if it
-// needs to be re-synced. If a source is deleted, it cleans up replicas.
-func handleEvent(event watch.Event, resource string, clientset *kubernetes.Clientset) {
-	name := GetName(event.Object)
-	switch event.Type {
-	case watch.Added:
-		fmt.Printf("%s created: %s", resource, name)
-		// If this is a source resource (has the sync label), trigger sync logic
-		if HasSyncSourceLabel(event.Object) {
-			fmt.Printf(" - found the source labels...\n")
-			CreateResource(clientset, event.Object)
-		}
-	case watch.Modified:
-		fmt.Printf("%s updated: %s\n", resource, name)
-		if HasSyncSourceLabel(event.Object) {
-			// If the source was updated, trigger sync logic
-			fmt.Printf(" - found the source labels...\n")
-			CreateResource(clientset, event.Object)
-		} else if IsMirrorverseReplica(event.Object) && !IsMarkedAsStale(event.Object) && HasSyncSourceRef(event.Object) {
-			// If a managed replica was updated, check if it needs to be re-synced
-			sourceName, sourceNamespace := GetSyncSourceRef(event.Object)
-			strategy := GetStrategy(event.Object)
-			sourceObj := GetSyncSourceObject(clientset, sourceName, sourceNamespace)
-			if NeedsSync(event.Object, sourceObj) { // Only update if needed
-				fmt.Printf(" - found the mirrorverse replica and needs sync...\n")
-				UpdateResource(clientset, sourceObj, strategy, GetNamespace(event.Object), GetName(event.Object))
-				UpdateLabelsLastSynced(event.Object, clientset)
-			} else {
-				fmt.Printf(" - found the mirrorverse replica but no sync needed. as no changes detected\n")
+// If a source exists, it syncs it to its targets. If a replica changed, it checks if it
+// needs to be re-synced. If a source is gone, it cleans up replicas.
+func (w *Watcher) reconcile(ctx context.Context, key resourceKey) error {
+	if key.Resource == policyResource || key.Resource == clusterPolicyResource {
+		return w.reconcilePolicy(ctx, key)
+	}
+	if key.Resource == namespaceResource {
+		return w.reconcileNamespace(key)
+	}
+	cached, err := w.getObject(key)
+	if apierrors.IsNotFound(err) {
+		// A MirrorPolicy referencing it reports the source as missing
+		w.enqueuePolicies(w.kindOfResource(key.Resource), key)
+		// If a source is deleted, trigger cleanup logic
+		source, ok := w.trackedSource(key)
+		if !ok {
+			return nil
+		}
+		fmt.Printf("%s deleted - found the source labels...\n", key)
+		return w.releaseSource(ctx, key, source)
+	}
+	if err != nil {
+		return err
+	}
+	// Never modify objects owned by the cache
+	obj := cached.DeepCopy()
+
+	if IsBeingDeleted(obj) && HasCleanupFinalizer(obj) {
+		// The source was deleted: clean up, then let Kubernetes finish the deletion
+		fmt.Printf("%s is being deleted - cleaning up before removing the finalizer...\n", key)
+		return w.finalizeSource(ctx, key, obj)
+	}
+	if HasSyncSourceLabel(obj) {
+		if IsBeingDeleted(obj) {
+			return nil // another finalizer holds it, cleanup runs once it is gone
+		}
+		if !w.sourceAllowed(obj) {
+			fmt.Printf("%s is not mirrored: %s\n", key, rbacRefusal)
+			recordEvent(w.recorder, obj, corev1.EventTypeWarning, ReasonRefused, "Not mirrored: %s", rbacRefusal)
+			if _, ok := w.trackedSource(key); ok || HasCleanupFinalizer(obj) {
+				// It was mirrored before the restriction applied: release its replicas
+				return w.finalizeSource(ctx, key, obj)
 			}
+			return nil
 		}
-	case watch.Deleted:
-		fmt.Printf("%s deleted: %s\n", resource, name)
-		// If a source is deleted, trigger cleanup logic
-		if HasSyncSourceLabel(event.Object) {
-			fmt.Printf(" - found the source labels...\n")
-			DeleteResource(clientset, event.Object)
+		fmt.Printf("%s changed - found the source labels...\n", key)
+		w.trackSource(key, obj)
+		if err := AddCleanupFinalizer(ctx, w.client(key.Resource), obj); err != nil {
+			return err
+		}
+		targets := w.targetNamespaces(obj)
+		results, err := CreateResource(ctx, w.client(key.Resource), w.recorder, obj, targets)
+		if statusErr := updateSyncStatus(ctx, w.client(key.Resource), obj, results); err == nil {
+			err = statusErr
 		}
-	case watch.Error:
-		fmt.Printf("Error event for %s: %v\n", resource, event.Object)
+		// The policy status is informational: failing to write it must not fail the sync.
+		// updatePolicyStatus retries it on its own.
+		w.updatePolicyStatus(ctx, obj, results)
+		// Prune even if some targets failed: a target that keeps failing must not keep
+		// the replicas of dropped namespaces around
+		return utilerrors.NewAggregate([]error{err, w.pruneReplicas(ctx, key, obj, targets)})
+	}
+	if _, ok := w.trackedSource(key); ok || HasCleanupFinalizer(obj) {
+		// The object still exists but is no longer a source
+		fmt.Printf("%s lost its source label, releasing its replicas...\n", key)
+		return w.finalizeSource(ctx, key, obj)
 	}
+	if IsMirrorverseReplica(obj) && !IsMarkedAsStale(obj) && HasSyncSourceRef(obj) {
+		// If a managed replica was updated, check if it needs to be re-synced
+		source, err := GetSyncSourceObject(w.sourceGetter(key.Resource), obj)
+		if apierrors.IsNotFound(err) {
+			return w.markStale(ctx, key.Resource, obj)
+		}
+		if err != nil {
+			return err
+		}
+		if key.Name != ReplicaName(source) {
+			return nil // an old version of a hashed immutable source, collected by collectOldVersions
+		}
+		if !w.sourceAllowed(source) {
+			return nil // released by the source, see rbacSourceAllowed
+		}
+		drift := DetectDrift(obj, source)
+		if len(drift) == 0 { // Only update if needed
+			fmt.Printf("%s - found the mirrorverse replica but no sync needed. as no changes detected\n", key)
+			return nil
+		}
+		ns, err := w.namespaceLister.Get(key.Namespace)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		if ns == nil || !targetsNamespace(source, ns) {
+			// No longer a target: let the source prune it
+			w.queue.Add(keyFor(key.Resource, source))
+			return nil
+		}
+		fmt.Printf("%s - found the mirrorverse replica and needs sync (%s)...\n", key, drift)
+		results, err := CreateResource(ctx, w.client(key.Resource), w.recorder, source, []string{key.Namespace})
+		if err == nil && len(results) == 1 && results[0].State == TargetSynced {
+			recordEvent(w.recorder, obj, corev1.EventTypeNormal, ReasonDriftRepaired, "Changes made outside the source were reverted: %s", drift)
+			recordEvent(w.recorder, source, corev1.EventTypeNormal, ReasonDriftRepaired, "Repaired drift of replica %s/%s: %s", key.Namespace, key.Name, drift)
+		}
+		return err
+	}
+	return nil
+}
+
+// releaseSource runs when a tracked source was deleted or lost its sync-source label.
+// Its replicas are deleted or marked stale following the mirrorverse.dev/cleanup
+// setting of the last version seen as a source, then the source is forgotten.
+// Namespaces that are gone or being deleted are skipped.
+func (w *Watcher) releaseSource(ctx context.Context, key resourceKey, source sourceState) error {
+	namespaces := unionNamespaces(w.syncedNamespaces(key, source.obj), w.targetNamespaces(source.obj))
+	if err := DeleteResource(ctx, w.client(key.Resource), w.recorder, source.obj, w.liveNamespaces(namespaces)); err != nil {
+		return err
+	}
+	forgetTargets(source.obj.GetKind(), SyncSourceRef(source.obj))
+	w.forgetSource(key)
+	return nil
+}
+
+// finalizeSource releases a source that still exists (being deleted, or no longer labelled
+// as a source) and removes its cleanup finalizer. The settings of the last version seen
+// as a source are used, falling back to obj itself, e.g. after a controller restart.
+func (w *Watcher) finalizeSource(ctx context.Context, key resourceKey, obj *unstructured.Unstructured) error {
+	source, ok := w.trackedSource(key)
+	if !ok || HasSyncSourceLabel(obj) {
+		source = sourceState{obj: obj}
+	}
+	if err := w.releaseSource(ctx, key, source); err != nil {
+		return err
+	}
+	// The finalizer patch is checked against obj's resourceVersion, so it goes first
+	if err := RemoveCleanupFinalizer(ctx, w.client(key.Resource), obj); err != nil {
+		return err
+	}
+	if IsBeingDeleted(obj) {
+		return nil
+	}
+	return clearSyncStatus(ctx, w.client(key.Resource), obj)
+}
+
+func (w *Watcher) trackSource(key resourceKey, obj *unstructured.Unstructured) {
+	w.sourcesMu.Lock()
+	defer w.sourcesMu.Unlock()
+	if state, ok := w.sources[key]; ok {
+		state.obj = obj
+		return
+	}
+	w.sources[key] = &sourceState{obj: obj}
+}
+
+func (w *Watcher) trackedSource(key resourceKey) (sourceState, bool) {
+	w.sourcesMu.Lock()
+	defer w.sourcesMu.Unlock()
+	state, ok := w.sources[key]
+	if !ok {
+		return sourceState{}, false
+	}
+	return *state, true
+}
+
+// setSyncedTargets records the namespaces a source was synced into and returns the previous ones.
+func (w *Watcher) setSyncedTargets(key resourceKey, targets []string) []string {
+	w.sourcesMu.Lock()
+	defer w.sourcesMu.Unlock()
+	state, ok := w.sources[key]
+	if !ok {
+		return nil
+	}
+	previous := state.targets
+	state.targets = targets
+	return previous
+}
+
+func (w *Watcher) forgetSource(key resourceKey) {
+	w.sourcesMu.Lock()
+	defer w.sourcesMu.Unlock()
+	delete(w.sources, key)
 }
@@ -0,0 +1,56 @@
+// logic to prune replicas from namespaces that are no longer targeted
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// replicaSelector matches every object Mirrorverse created as a replica.
+var replicaSelector = labels.SelectorFromSet(labels.Set{"mirrorverse.dev/sync-replica": "true"})
+
+// pruneReplicas removes the replicas of a source from every namespace it no longer targets,
+// e.g. after its targets changed from "a, b, c" to "a, b", or a namespace stopped matching
+// its selector. Dropped replicas are deleted or marked stale following the source's
+// mirrorverse.dev/cleanup setting, exactly like when the source itself is deleted.
+func (w *Watcher) pruneReplicas(ctx context.Context, key resourceKey, source *unstructured.Unstructured, targets []string) error {
+	dropped := differenceNamespaces(w.syncedNamespaces(key, source), targets)
+	if len(dropped) == 0 {
+		w.setSyncedTargets(key, targets)
+		return w.collectOldVersions(ctx, key, source, targets)
+	}
+	fmt.Printf("%s no longer targets %v, cleaning up...\n", key, dropped)
+	if err := DeleteResource(ctx, w.client(key.Resource), w.recorder, source, dropped); err != nil {
+		// Keep the dropped namespaces around so the retry prunes them again
+		w.setSyncedTargets(key, unionNamespaces(targets, dropped))
+		return err
+	}
+	forgetTargets(source.GetKind(), SyncSourceRef(source), dropped...)
+	w.setSyncedTargets(key, targets)
+	return w.collectOldVersions(ctx, key, source, targets)
+}
+
+// syncedNamespaces returns the namespaces that currently hold a live (not stale) replica
+// of the source. They are found by listing replicas in the cache and matching their
+// mirrorverse.dev/sync-source-ref, so the result survives a controller restart. Namespaces
+// synced into by this process but not yet visible in the cache are added from memory.
+func (w *Watcher) syncedNamespaces(key resourceKey, source *unstructured.Unstructured) []string {
+	var namespaces []string
+	if state, ok := w.trackedSource(key); ok {
+		namespaces = append(namespaces, state.targets...)
+	}
+	replicas, err := w.listObjects(key.Resource, replicaSelector)
+	if err != nil {
+		fmt.Printf("Error listing replicas of %s: %v\n", key, err)
+		return namespaces
+	}
+	for _, replica := range replicas {
+		if IsReplicaOf(replica, source) && !IsMarkedAsStale(replica) {
+			namespaces = append(namespaces, replica.GetNamespace())
+		}
+	}
+	return FilterNamespaces(namespaces, nil)
+}
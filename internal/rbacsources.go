@@ -0,0 +1,43 @@
+// restriction on which Roles and RoleBindings may be sources
+package internal
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// rbacGroup is the API group of Roles and RoleBindings.
+const rbacGroup = "rbac.authorization.k8s.io"
+
+// rbacRefusal explains to source authors why their RBAC source is not mirrored.
+const rbacRefusal = "RBAC objects are only mirrored by a ClusterMirrorPolicy or from a namespace allowed by --rbac-source-namespaces"
+
+// rbacSourceAllowed tells whether an object of kind gk in namespace may be a source.
+//
+// Mirroring a Role or RoleBinding needs the escalate and bind verbs, so the controller
+// can grant any permission. Without this check, anyone allowed to label a RoleBinding
+// in their own namespace could target kube-system and bind themselves admin there.
+// So RBAC sources must be chosen by the platform team: through a ClusterMirrorPolicy,
+// which also decides the targets, or in one of the rbacSourceNamespaces.
+func (w *Watcher) rbacSourceAllowed(gk schema.GroupKind, namespace string, clusterPolicy bool) bool {
+	if gk.Group != rbacGroup || clusterPolicy {
+		return true
+	}
+	return containsNamespace(w.rbacSourceNamespaces, namespace)
+}
+
+// sourceAllowed tells whether a source may be mirrored (see rbacSourceAllowed).
+func (w *Watcher) sourceAllowed(obj *unstructured.Unstructured) bool {
+	policy := w.activePolicy(obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	return w.rbacSourceAllowed(obj.GroupVersionKind().GroupKind(), obj.GetNamespace(), policy != nil && isClusterPolicy(policy))
+}
+
+// groupKindOfResource returns the group and kind of a mirrored resource, e.g. "rbac.authorization.k8s.io", "Role".
+func (w *Watcher) groupKindOfResource(resource string) schema.GroupKind {
+	for _, r := range w.resources {
+		if r.Name == resource {
+			return r.GVK.GroupKind()
+		}
+	}
+	return schema.GroupKind{}
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSourceAllowed(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	roleBinding := func(namespace string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(rbacGroup + "/v1")
+		obj.SetKind("RoleBinding")
+		obj.SetNamespace(namespace)
+		obj.SetName("app")
+		return obj
+	}
+	rbacPolicy := func(namespace string) *unstructured.Unstructured {
+		policy := testPolicy(namespace, "admins", created, "*")
+		if err := unstructured.SetNestedField(policy.Object, "RoleBinding", "spec", "source", "kind"); err != nil {
+			t.Fatal(err)
+		}
+		return policy
+	}
+
+	tests := []struct {
+		name     string
+		obj      *unstructured.Unstructured
+		cluster  []*unstructured.Unstructured
+		policies []*unstructured.Unstructured
+		want     bool
+	}{
+		{name: "other kinds", obj: configMap("platform", "app", nil, nil, nil), want: true},
+		{name: "RBAC source in any namespace", obj: roleBinding("tenant-a")},
+		{name: "RBAC source in an allowed namespace", obj: roleBinding("trusted"), want: true},
+		{
+			name:     "RBAC source of a MirrorPolicy",
+			obj:      roleBinding("platform"),
+			policies: []*unstructured.Unstructured{rbacPolicy("platform")},
+		},
+		{
+			name:    "RBAC source of a ClusterMirrorPolicy",
+			obj:     roleBinding("platform"),
+			cluster: []*unstructured.Unstructured{rbacPolicy("")},
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Watcher{
+				clusterPolicyInformer: policyIndexer(t, tt.cluster...),
+				policyInformer:        policyIndexer(t, tt.policies...),
+				rbacSourceNamespaces:  []string{"trusted"},
+			}
+			if got := w.sourceAllowed(tt.obj); got != tt.want {
+				t.Errorf("sourceAllowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
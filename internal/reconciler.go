@@ -0,0 +1,119 @@
+// periodic full resync of every source and replica
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// resyncAll is the "Reconciler Loop" from the README. Events alone can be missed
+// (controller down, a write that failed for good, a replica edited by hand), so every
+// interval it walks the whole cache:
+//   - every source whose replica is missing in a target namespace is enqueued, which recreates it
+//   - every replica whose data drifted from its source gets its source enqueued, which re-syncs it
+//   - every replica whose source is gone is enqueued, which marks it `mirrorverse.dev/stale: "true"`
+//
+// The actual writes happen on the workers, so a full pass only costs cache reads.
+func (w *Watcher) resyncAll(ctx context.Context) {
+	fmt.Println("Starting full resync...")
+	for _, resource := range w.resourceNames() {
+		objects, err := w.listObjects(resource, labels.Everything())
+		if err != nil {
+			fmt.Printf("Error listing %s for resync: %v\n", resource, err)
+			continue
+		}
+		for _, obj := range objects {
+			switch {
+			case HasSyncSourceLabel(obj):
+				w.resyncSource(resource, obj)
+			case IsMirrorverseReplica(obj) && !IsMarkedAsStale(obj) && HasSyncSourceRef(obj):
+				w.resyncReplica(resource, obj)
+			}
+		}
+	}
+}
+
+// resyncSource enqueues the source if any of its target namespaces lacks a replica.
+func (w *Watcher) resyncSource(resource string, source *unstructured.Unstructured) {
+	if !w.sourceAllowed(source) {
+		return
+	}
+	for _, namespace := range w.targetNamespaces(source) {
+		_, err := w.getObject(resourceKey{Resource: resource, Namespace: namespace, Name: ReplicaName(source)})
+		if apierrors.IsNotFound(err) {
+			fmt.Printf("Replica of %s/%s missing in namespace %s, re-syncing\n", source.GetNamespace(), source.GetName(), namespace)
+			w.queue.Add(keyFor(resource, source))
+			return
+		}
+	}
+}
+
+// resyncReplica enqueues a replica that drifted from its source or lost it.
+func (w *Watcher) resyncReplica(resource string, replica *unstructured.Unstructured) {
+	source, err := GetSyncSourceObject(w.sourceGetter(resource), replica)
+	if apierrors.IsNotFound(err) {
+		// Reconciling the replica marks it stale
+		fmt.Printf("Source of replica %s/%s is gone, marking it stale\n", replica.GetNamespace(), replica.GetName())
+		w.queue.Add(keyFor(resource, replica))
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error reading source of %s/%s for resync: %v\n", replica.GetNamespace(), replica.GetName(), err)
+		return
+	}
+	sourceKey := keyFor(resource, source)
+	if replica.GetName() != ReplicaName(source) {
+		return // an old version of a hashed immutable source, collected by collectOldVersions
+	}
+	if drift := DetectDrift(replica, source); len(drift) > 0 {
+		// Reconciling the replica repairs it (or has its source prune it) and records DriftRepaired
+		fmt.Printf("Replica %s/%s drifted from %s (%s), re-syncing\n", replica.GetNamespace(), replica.GetName(), sourceKey, drift)
+		w.queue.Add(keyFor(resource, replica))
+	}
+}
+
+// markStale labels an orphaned replica as stale so it is skipped from now on.
+func (w *Watcher) markStale(ctx context.Context, resource string, replica *unstructured.Unstructured) error {
+	obj := replica.DeepCopy()
+	staleLabels := make(map[string]string)
+	for k, v := range obj.GetLabels() {
+		staleLabels[k] = v
+	}
+	staleLabels["mirrorverse.dev/stale"] = "true"
+	fmt.Printf("Source of %s/%s no longer exists, marking it as stale\n", obj.GetNamespace(), obj.GetName())
+	ctx, cancel := context.WithTimeout(ctx, w.reconcileTimeout)
+	defer cancel()
+	if err := UpdateLabels(ctx, obj, w.client(resource), staleLabels); err != nil {
+		return err
+	}
+	name, namespace := GetSyncSourceRef(obj)
+	recordEvent(w.recorder, obj, corev1.EventTypeWarning, ReasonMarkedStale, "Source %s/%s no longer exists, marked as stale", namespace, name)
+	return nil
+}
+
+// listObjects returns every cached object of the given resource type that matches selector,
+// with the settings of their MirrorPolicy (see withPolicy).
+func (w *Watcher) listObjects(resource string, selector labels.Selector) ([]*unstructured.Unstructured, error) {
+	lister, ok := w.listers[resource]
+	if !ok {
+		return nil, fmt.Errorf("unknown resource: %s", resource)
+	}
+	items, err := lister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]*unstructured.Unstructured, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object of type %T in %s cache", item, resource)
+		}
+		objects = append(objects, w.withPolicy(obj))
+	}
+	return objects, nil
+}
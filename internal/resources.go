@@ -0,0 +1,116 @@
+// the kinds Mirrorverse mirrors, and what a replica must not copy from its source
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+)
+
+// DefaultResources are mirrored when no resources are configured.
+var DefaultResources = []string{"configmaps", "secrets"}
+
+// Resource is a namespaced kind Mirrorverse watches and mirrors.
+type Resource struct {
+	// Name is how the resource is configured, e.g. "secrets" or "networkpolicies.networking.k8s.io".
+	// It is also the Resource of every queue key for this kind.
+	Name string
+	GVR  schema.GroupVersionResource
+	GVK  schema.GroupVersionKind
+}
+
+// ResolveResources looks up each configured resource through API discovery and picks
+// its preferred version. Names are "<plural>" for the core group and "<plural>.<group>"
+// otherwise, the same form kubectl accepts (e.g. "roles.rbac.authorization.k8s.io").
+// Custom resources work the same way, as long as their CRD is installed.
+func ResolveResources(clientset kubernetes.Interface, names []string) ([]Resource, error) {
+	groupResources, err := restmapper.GetAPIGroupResources(clientset.Discovery())
+	if err != nil {
+		return nil, fmt.Errorf("discovering API resources: %w", err)
+	}
+	mapper := restmapper.NewDiscoveryRESTMapper(groupResources)
+
+	var resources []Resource
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		gvr, err := mapper.ResourceFor(schema.ParseGroupResource(name).WithVersion(""))
+		if err != nil {
+			return nil, fmt.Errorf("unknown resource %q: %w", name, err)
+		}
+		gvk, err := mapper.KindFor(gvr)
+		if err != nil {
+			return nil, fmt.Errorf("unknown kind for resource %q: %w", name, err)
+		}
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, fmt.Errorf("mapping resource %q: %w", name, err)
+		}
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			return nil, fmt.Errorf("resource %q is cluster-scoped, only namespaced resources can be mirrored", name)
+		}
+		resources = append(resources, Resource{Name: name, GVR: gvr, GVK: gvk})
+	}
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("no resources to mirror")
+	}
+	return resources, nil
+}
+
+// metadataFields belong to one object only and are never copied into a replica.
+// The source's finalizers (mirrorverse.dev/cleanup among them) and deletion state are its own,
+// and owner references cannot point across namespaces.
+var metadataFields = []string{
+	"namespace", "uid", "resourceVersion", "generation", "selfLink", "creationTimestamp",
+	"managedFields", "finalizers", "deletionTimestamp", "deletionGracePeriodSeconds", "ownerReferences",
+}
+
+// stripFields lists, per kind, the fields of a source that only make sense in its own
+// namespace or are assigned by the cluster. They are left out of replicas and ignored
+// when comparing a replica with its source. Every kind also loses `status` and the
+// metadataFields above.
+var stripFields = map[schema.GroupKind][][]string{
+	// token Secrets are created per namespace
+	{Kind: "ServiceAccount"}: {{"secrets"}},
+	// allocated by the cluster, per Service
+	{Kind: "Service"}: {{"spec", "clusterIP"}, {"spec", "clusterIPs"}, {"spec", "healthCheckNodePort"}},
+	// bound by the cluster, per claim
+	{Kind: "PersistentVolumeClaim"}: {{"spec", "volumeName"}},
+}
+
+// StripReplicaFields removes from obj everything a replica must not copy from its source.
+func StripReplicaFields(obj *unstructured.Unstructured) {
+	unstructured.RemoveNestedField(obj.Object, "status")
+	for _, field := range metadataFields {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	for _, path := range stripFields[obj.GroupVersionKind().GroupKind()] {
+		unstructured.RemoveNestedField(obj.Object, path...)
+	}
+}
+
+// contentFields returns the top-level fields of obj that carry its content, e.g.
+// data and type for a Secret or spec for a NetworkPolicy: everything except the
+// type information, metadata and status.
+func contentFields(obj *unstructured.Unstructured) []string {
+	var fields []string
+	for _, field := range sortedKeys(obj.Object) {
+		switch field {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		if obj.Object[field] != nil {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,183 @@
+// per-target sync status, written to the source and to its policy
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// SyncStatusAnnotation is written to every source by the controller. It holds a JSON
+// SyncStatus, so `kubectl get cm my-config -o yaml` shows which targets are behind.
+const SyncStatusAnnotation = "mirrorverse.dev/sync-status"
+
+// Values of TargetStatus.State
+const (
+	TargetSynced           = "synced"            // the replica matches the source
+	TargetConflict         = "conflict"          // an object not managed by the source is in the way
+	TargetForbidden        = "forbidden"         // the controller is not allowed to write there (RBAC, admission)
+	TargetNamespaceMissing = "namespace-missing" // the namespace does not exist (yet), it is synced once it does
+	TargetFailed           = "failed"            // any other error, retried with backoff
+)
+
+// TargetStatus is the outcome of syncing a source into one target namespace.
+type TargetStatus struct {
+	Namespace string `json:"namespace"`
+	State     string `json:"state"`
+	// LastSyncTime is when the namespace was last synced successfully. It is kept while syncs fail.
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// LastError is the error of the last sync, empty once it succeeds.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// SyncStatus is the value of SyncStatusAnnotation.
+type SyncStatus struct {
+	// LastSyncTime is when the source was last synced, successfully or not.
+	LastSyncTime metav1.Time    `json:"lastSyncTime"`
+	Targets      []TargetStatus `json:"targets"`
+}
+
+// targetResult turns the error of syncing into one namespace into its TargetStatus.
+func targetResult(namespace string, err error) TargetStatus {
+	result := TargetStatus{Namespace: namespace, State: TargetSynced}
+	if err == nil {
+		now := metav1.Now()
+		result.LastSyncTime = &now
+		return result
+	}
+	result.LastError = err.Error()
+	var status apierrors.APIStatus
+	switch {
+	case errors.Is(err, errNotOwned), errors.Is(err, errFieldConflict):
+		result.State = TargetConflict
+	case apierrors.IsForbidden(err):
+		result.State = TargetForbidden
+	case apierrors.IsNotFound(err) && errors.As(err, &status) && status.Status().Details != nil && status.Status().Details.Kind == "namespaces":
+		result.State = TargetNamespaceMissing
+	default:
+		result.State = TargetFailed
+	}
+	return result
+}
+
+// mergeTargetTimes carries the LastSyncTime of namespaces that failed this time over
+// from the previous results, so it keeps saying when they were last in sync.
+func mergeTargetTimes(results, previous []TargetStatus) []TargetStatus {
+	last := map[string]*metav1.Time{}
+	for _, p := range previous {
+		last[p.Namespace] = p.LastSyncTime
+	}
+	merged := make([]TargetStatus, len(results))
+	for i, r := range results {
+		if r.LastSyncTime == nil {
+			r.LastSyncTime = last[r.Namespace]
+		}
+		merged[i] = r
+	}
+	return merged
+}
+
+// keepSettledTimes keeps the previous LastSyncTime of targets whose state and error did
+// not change, so a status that only differs by the time of the last sync is not rewritten.
+func keepSettledTimes(results, previous []TargetStatus) []TargetStatus {
+	last := map[string]TargetStatus{}
+	for _, p := range previous {
+		last[p.Namespace] = p
+	}
+	kept := make([]TargetStatus, len(results))
+	for i, r := range results {
+		if p, ok := last[r.Namespace]; ok && p.State == r.State && p.LastError == r.LastError && p.LastSyncTime != nil {
+			r.LastSyncTime = p.LastSyncTime
+		}
+		kept[i] = r
+	}
+	return kept
+}
+
+// GetSyncStatus reads SyncStatusAnnotation of a source. ok is false if it is missing or unreadable.
+func GetSyncStatus(obj *unstructured.Unstructured) (status SyncStatus, ok bool) {
+	value, found := obj.GetAnnotations()[SyncStatusAnnotation]
+	if !found {
+		return SyncStatus{}, false
+	}
+	if err := json.Unmarshal([]byte(value), &status); err != nil {
+		return SyncStatus{}, false
+	}
+	return status, true
+}
+
+// updateSyncStatus writes the results of syncing a source to its SyncStatusAnnotation.
+// Only the annotation is patched, never the whole object: the source may carry the
+// settings of a MirrorPolicy that must not end up on it. The write comes back as an
+// update event, which the event handler ignores (see onlySyncStatusChanged).
+func updateSyncStatus(ctx context.Context, client dynamic.NamespaceableResourceInterface, source *unstructured.Unstructured, results []TargetStatus) error {
+	previous, _ := GetSyncStatus(source)
+	status := SyncStatus{LastSyncTime: metav1.NewTime(time.Now().UTC()), Targets: mergeTargetTimes(results, previous.Targets)}
+	if status.Targets == nil {
+		status.Targets = []TargetStatus{}
+	}
+	value, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return patchSyncStatus(ctx, client, source, string(value))
+}
+
+// clearSyncStatus removes SyncStatusAnnotation from an object that is no longer a source.
+func clearSyncStatus(ctx context.Context, client dynamic.NamespaceableResourceInterface, obj *unstructured.Unstructured) error {
+	if _, ok := obj.GetAnnotations()[SyncStatusAnnotation]; !ok {
+		return nil
+	}
+	return patchSyncStatus(ctx, client, obj, nil)
+}
+
+// patchSyncStatus sets SyncStatusAnnotation to value, or removes it if value is nil.
+func patchSyncStatus(ctx context.Context, client dynamic.NamespaceableResourceInterface, obj *unstructured.Unstructured, value interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{SyncStatusAnnotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.Namespace(obj.GetNamespace()).Patch(ctx, obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil // deleted meanwhile, nothing to report on
+	}
+	if err != nil {
+		fmt.Printf("Failed to update %s of %s/%s: %v\n", SyncStatusAnnotation, obj.GetNamespace(), obj.GetName(), err)
+	}
+	return err
+}
+
+// onlySyncStatusChanged reports whether an update of an object changed nothing but its
+// SyncStatusAnnotation, i.e. it is the controller's own status write. Reconciling it
+// again would write a new status, and so on forever.
+func onlySyncStatusChanged(oldObj, newObj *unstructured.Unstructured) bool {
+	if oldObj.GetAnnotations()[SyncStatusAnnotation] == newObj.GetAnnotations()[SyncStatusAnnotation] {
+		return false
+	}
+	strip := func(obj *unstructured.Unstructured) map[string]interface{} {
+		obj = obj.DeepCopy()
+		annotations := obj.GetAnnotations()
+		delete(annotations, SyncStatusAnnotation)
+		if len(annotations) == 0 {
+			annotations = nil // the first status write adds the annotations map
+		}
+		obj.SetAnnotations(annotations)
+		obj.SetResourceVersion("")
+		obj.SetManagedFields(nil)
+		return obj.Object
+	}
+	return equality.Semantic.DeepEqual(strip(oldObj), strip(newObj))
+}
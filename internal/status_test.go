@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestTargetResult(t *testing.T) {
+	configMaps := schema.GroupResource{Resource: "configmaps"}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "synced", want: TargetSynced},
+		{name: "not owned", err: &notOwnedError{}, want: TargetConflict},
+		{name: "field conflict", err: &fieldConflictError{cause: errors.New("conflict")}, want: TargetConflict},
+		{name: "forbidden", err: apierrors.NewForbidden(configMaps, "app", errors.New("denied")), want: TargetForbidden},
+		{name: "namespace missing", err: apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "staging"), want: TargetNamespaceMissing},
+		{name: "other not found", err: apierrors.NewNotFound(configMaps, "app"), want: TargetFailed},
+		{name: "other error", err: errors.New("timeout"), want: TargetFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := targetResult("staging", tt.err)
+			if got.Namespace != "staging" || got.State != tt.want {
+				t.Errorf("targetResult = %+v, want state %s", got, tt.want)
+			}
+			if tt.err == nil {
+				if got.LastSyncTime == nil || got.LastError != "" {
+					t.Errorf("synced target = %+v, want a LastSyncTime and no LastError", got)
+				}
+				return
+			}
+			if got.LastSyncTime != nil || got.LastError != tt.err.Error() {
+				t.Errorf("failed target = %+v, want no LastSyncTime and LastError %q", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestKeepSettledTimes(t *testing.T) {
+	before := metav1.NewTime(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+	now := metav1.NewTime(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name     string
+		results  []TargetStatus
+		previous []TargetStatus
+		want     *metav1.Time
+	}{
+		{
+			name:     "still synced keeps the time",
+			results:  []TargetStatus{{Namespace: "a", State: TargetSynced, LastSyncTime: &now}},
+			previous: []TargetStatus{{Namespace: "a", State: TargetSynced, LastSyncTime: &before}},
+			want:     &before,
+		},
+		{
+			name:     "synced again after a failure moves the time",
+			results:  []TargetStatus{{Namespace: "a", State: TargetSynced, LastSyncTime: &now}},
+			previous: []TargetStatus{{Namespace: "a", State: TargetFailed, LastSyncTime: &before, LastError: "timeout"}},
+			want:     &now,
+		},
+		{
+			name:     "a different error moves the time",
+			results:  []TargetStatus{{Namespace: "a", State: TargetFailed, LastSyncTime: &now, LastError: "denied"}},
+			previous: []TargetStatus{{Namespace: "a", State: TargetFailed, LastSyncTime: &before, LastError: "timeout"}},
+			want:     &now,
+		},
+		{
+			name:    "new target",
+			results: []TargetStatus{{Namespace: "a", State: TargetSynced, LastSyncTime: &now}},
+			want:    &now,
+		},
+		{
+			name:     "never synced before",
+			results:  []TargetStatus{{Namespace: "a", State: TargetSynced, LastSyncTime: &now}},
+			previous: []TargetStatus{{Namespace: "a", State: TargetSynced}},
+			want:     &now,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := keepSettledTimes(tt.results, tt.previous)
+			if len(got) != 1 || !reflect.DeepEqual(got[0].LastSyncTime, tt.want) {
+				t.Errorf("keepSettledTimes = %+v, want LastSyncTime %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnlySyncStatusChanged(t *testing.T) {
+	withStatus := func(obj *unstructured.Unstructured, status string) *unstructured.Unstructured {
+		obj = obj.DeepCopy()
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[SyncStatusAnnotation] = status
+		obj.SetAnnotations(annotations)
+		return obj
+	}
+	withVersion := func(obj *unstructured.Unstructured, version string) *unstructured.Unstructured {
+		obj = obj.DeepCopy()
+		obj.SetResourceVersion(version)
+		return obj
+	}
+	source := configMap("default", "app", map[string]string{"mirrorverse.dev/sync-source": "true"},
+		map[string]string{TargetsAnnotation: "staging"}, map[string]interface{}{"a": "1"})
+	bare := configMap("default", "app", nil, nil, map[string]interface{}{"a": "1"})
+
+	tests := []struct {
+		name     string
+		old, new *unstructured.Unstructured
+		want     bool
+	}{
+		{
+			name: "status written",
+			old:  withVersion(withStatus(source, `{"targets":[]}`), "1"),
+			new:  withVersion(withStatus(source, `{"targets":[{"namespace":"staging"}]}`), "2"),
+			want: true,
+		},
+		{
+			name: "first status write adds the annotation",
+			old:  withVersion(source, "1"),
+			new:  withVersion(withStatus(source, `{}`), "2"),
+			want: true,
+		},
+		{
+			name: "first status write adds the annotations map",
+			old:  withVersion(bare, "1"),
+			new:  withVersion(withStatus(bare, `{}`), "2"),
+			want: true,
+		},
+		{
+			name: "status removed",
+			old:  withVersion(withStatus(bare, `{}`), "1"),
+			new:  withVersion(bare, "2"),
+			want: true,
+		},
+		{
+			name: "status unchanged",
+			old:  withVersion(withStatus(source, `{}`), "1"),
+			new:  withVersion(withStatus(source, `{}`), "2"),
+		},
+		{
+			name: "status and data changed",
+			old:  withVersion(withStatus(source, `{}`), "1"),
+			new: func() *unstructured.Unstructured {
+				obj := withVersion(withStatus(source, `{"targets":[]}`), "2")
+				obj.Object["data"] = map[string]interface{}{"a": "2"}
+				return obj
+			}(),
+		},
+		{
+			name: "status and another annotation changed",
+			old:  withVersion(withStatus(source, `{}`), "1"),
+			new: func() *unstructured.Unstructured {
+				obj := withVersion(withStatus(source, `{"targets":[]}`), "2")
+				annotations := obj.GetAnnotations()
+				annotations[TargetsAnnotation] = "staging,prod"
+				obj.SetAnnotations(annotations)
+				return obj
+			}(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := onlySyncStatusChanged(tt.old, tt.new); got != tt.want {
+				t.Errorf("onlySyncStatusChanged = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
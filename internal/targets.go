@@ -0,0 +1,341 @@
+// resolving which namespaces a source syncs into
+package internal
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TargetSelectorAnnotation selects target namespaces by their labels, e.g. "team=payments".
+// It is an annotation because label values cannot hold a selector.
+const TargetSelectorAnnotation = "mirrorverse.dev/target-selector"
+
+// OptOutAnnotation lets a namespace decline replicas. It is set on the Namespace and lists
+// the sources ("<name>.<namespace>", like mirrorverse.dev/sync-source-ref) it does not
+// want, or "*" for all of them. Opting out works like removing the namespace from the
+// source's targets: an existing replica is deleted or marked stale, and a deleted one
+// is not recreated.
+const OptOutAnnotation = "mirrorverse.dev/opt-out"
+
+// namespaceResource is the queue key resource of a new Namespace, see reconcileNamespace.
+const namespaceResource = "namespaces"
+
+// RegexPrefix marks a targets/exclude entry as a regular expression, e.g. "re:^prod-[a-z]+$".
+const RegexPrefix = "re:"
+
+// targetNamespaces resolves the namespaces a source syncs into: the
+// mirrorverse.dev/targets list plus every namespace matching the
+// mirrorverse.dev/target-selector annotation, minus mirrorverse.dev/exclude.
+// Entries of targets and exclude may be names or patterns (see expandPatterns).
+// Exclude always wins, and the source's own namespace is never a target.
+func (w *Watcher) targetNamespaces(obj *unstructured.Unstructured) []string {
+	targets := w.expandPatterns(obj, GetConfigList(obj, TargetsAnnotation))
+	if selector := obj.GetAnnotations()[TargetSelectorAnnotation]; selector != "" {
+		targets = append(targets, w.selectNamespaces(obj, selector)...)
+	}
+	exclude := append(w.expandPatterns(obj, GetConfigList(obj, ExcludeAnnotation)), obj.GetNamespace())
+	return FilterNamespaces(targets, append(exclude, w.optedOutNamespaces(obj)...))
+}
+
+// optedOutNamespaces returns the namespaces whose OptOutAnnotation declines the source.
+func (w *Watcher) optedOutNamespaces(obj *unstructured.Unstructured) []string {
+	namespaces, err := w.namespaceLister.List(labels.Everything())
+	if err != nil {
+		fmt.Printf("Error listing namespaces for opt-outs: %v\n", err)
+		return nil
+	}
+	ref := SyncSourceRef(obj)
+	var optedOut []string
+	for _, ns := range namespaces {
+		if declines(ns, ref) {
+			optedOut = append(optedOut, ns.Name)
+		}
+	}
+	return optedOut
+}
+
+// declines reports whether the OptOutAnnotation of a namespace declines the source ref.
+func declines(ns *corev1.Namespace, ref string) bool {
+	value, ok := ns.Annotations[OptOutAnnotation]
+	if !ok {
+		return false
+	}
+	declined, err := ParseList(value)
+	if err != nil {
+		fmt.Printf("Invalid %s on namespace %s: %v\n", OptOutAnnotation, ns.Name, err)
+		return false
+	}
+	for _, d := range declined {
+		if d == "*" || d == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// targetsNamespace tells whether a source syncs into one namespace. It gives the same
+// answer as checking targetNamespaces, but only looks at that namespace instead of
+// listing all of them, so it stays cheap when many namespaces and sources exist.
+func targetsNamespace(obj *unstructured.Unstructured, ns *corev1.Namespace) bool {
+	if ns.Name == obj.GetNamespace() || declines(ns, SyncSourceRef(obj)) {
+		return false
+	}
+	if matchesAny(obj, GetConfigList(obj, ExcludeAnnotation), ns.Name) {
+		return false
+	}
+	if matchesAny(obj, GetConfigList(obj, TargetsAnnotation), ns.Name) {
+		return true
+	}
+	selector := obj.GetAnnotations()[TargetSelectorAnnotation]
+	if selector == "" {
+		return false
+	}
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return false // reported when the source is reconciled
+	}
+	return parsed.Matches(labels.Set(ns.Labels))
+}
+
+// matchesAny tells whether a namespace name is one of the targets/exclude entries,
+// either by name or by pattern (see expandPatterns).
+func matchesAny(obj *unstructured.Unstructured, entries []string, namespace string) bool {
+	for _, entry := range entries {
+		if !isPattern(entry) {
+			if entry == namespace {
+				return true
+			}
+			continue
+		}
+		match, err := namespaceMatcher(entry)
+		if err != nil {
+			continue // reported when the source is reconciled
+		}
+		if match(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandPatterns resolves pattern entries against the live namespace list:
+//   - "*" matches every namespace
+//   - "tenant-*" is a glob (see https://pkg.go.dev/path#Match)
+//   - "re:^prod-[a-z]+$" is a regular expression
+//
+// Plain names are returned as they are, whether the namespace exists or not.
+func (w *Watcher) expandPatterns(obj *unstructured.Unstructured, entries []string) []string {
+	var names, patterns []string
+	for _, entry := range entries {
+		if isPattern(entry) {
+			patterns = append(patterns, entry)
+		} else {
+			names = append(names, entry)
+		}
+	}
+	if len(patterns) == 0 {
+		return names
+	}
+	namespaces, err := w.namespaceLister.List(labels.Everything())
+	if err != nil {
+		fmt.Printf("Error listing namespaces for patterns %v: %v\n", patterns, err)
+		return names
+	}
+	var matched []string
+	for _, pattern := range patterns {
+		match, err := namespaceMatcher(pattern)
+		if err != nil {
+			fmt.Printf("Invalid namespace pattern '%s' on %s/%s: %v\n", pattern, obj.GetNamespace(), obj.GetName(), err)
+			continue
+		}
+		for _, ns := range namespaces {
+			if match(ns.Name) {
+				matched = append(matched, ns.Name)
+			}
+		}
+	}
+	sort.Strings(matched)
+	return append(names, matched...)
+}
+
+// isPattern reports whether a targets/exclude entry is a pattern rather than a namespace name.
+// Namespace names cannot contain any of these characters, so there is no ambiguity.
+func isPattern(entry string) bool {
+	return strings.HasPrefix(entry, RegexPrefix) || strings.ContainsAny(entry, "*?[")
+}
+
+// namespaceMatcher compiles a glob or "re:" pattern into a match function.
+func namespaceMatcher(pattern string) (func(string) bool, error) {
+	if strings.HasPrefix(pattern, RegexPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, RegexPrefix))
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	// Validate the glob once so a typo is reported instead of silently matching nothing
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return func(name string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}, nil
+}
+
+// selectNamespaces returns the names of all cached namespaces matching a label selector.
+func (w *Watcher) selectNamespaces(obj *unstructured.Unstructured, selector string) []string {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		fmt.Printf("Invalid %s '%s' on %s/%s: %v\n", TargetSelectorAnnotation, selector, obj.GetNamespace(), obj.GetName(), err)
+		return nil
+	}
+	namespaces, err := w.namespaceLister.List(parsed)
+	if err != nil {
+		fmt.Printf("Error listing namespaces for selector '%s': %v\n", selector, err)
+		return nil
+	}
+	names := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		names = append(names, ns.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namespaceEventHandler keeps replicas in line with the namespaces that exist:
+//   - a new namespace gets a replica of every source that targets it, right away
+//     (the sources are looked up on a worker, see reconcileNamespace)
+//   - a namespace whose labels change re-evaluates selector-based targets, so replicas
+//     appear in namespaces that start matching and disappear from ones that stop
+//   - a namespace whose opt-out annotation changes re-evaluates every source
+//   - a deleted namespace is forgotten by every source
+func (w *Watcher) namespaceEventHandler() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			// The namespaces of the initial list are no news: every source is
+			// enqueued by its own Add event at startup anyway
+			if !w.namespacesSynced() {
+				return
+			}
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				w.queue.Add(resourceKey{Resource: namespaceResource, Name: ns.Name})
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				w.forgetNamespace(ns.Name)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNS, ok := oldObj.(*corev1.Namespace)
+			if !ok {
+				return
+			}
+			newNS, ok := newObj.(*corev1.Namespace)
+			if !ok {
+				return
+			}
+			if oldNS.Annotations[OptOutAnnotation] != newNS.Annotations[OptOutAnnotation] {
+				fmt.Printf("Opt-outs of namespace %s changed, re-evaluating all sources...\n", newNS.Name)
+				w.enqueueSources(func(obj *unstructured.Unstructured) bool { return true })
+				return
+			}
+			if labels.Equals(oldNS.Labels, newNS.Labels) {
+				return
+			}
+			fmt.Printf("Labels of namespace %s changed, re-evaluating target selectors...\n", newNS.Name)
+			w.enqueueSources(func(obj *unstructured.Unstructured) bool {
+				return obj.GetAnnotations()[TargetSelectorAnnotation] != ""
+			})
+		},
+	}
+}
+
+// enqueueSources enqueues every source for which match returns true.
+func (w *Watcher) enqueueSources(match func(obj *unstructured.Unstructured) bool) {
+	for _, resource := range w.resourceNames() {
+		objects, err := w.listObjects(resource, labels.Everything())
+		if err != nil {
+			fmt.Printf("Error listing %s: %v\n", resource, err)
+			continue
+		}
+		for _, obj := range objects {
+			if HasSyncSourceLabel(obj) && match(obj) {
+				w.enqueue(resource, obj)
+			}
+		}
+	}
+}
+
+// reconcileNamespace enqueues every source that targets a new namespace.
+func (w *Watcher) reconcileNamespace(key resourceKey) error {
+	ns, err := w.namespaceLister.Get(key.Name)
+	if apierrors.IsNotFound(err) {
+		return nil // deleted in the meantime
+	}
+	if err != nil {
+		return err
+	}
+	w.enqueueSourcesTargeting(ns)
+	return nil
+}
+
+// enqueueSourcesTargeting enqueues every source whose target set includes the namespace.
+func (w *Watcher) enqueueSourcesTargeting(ns *corev1.Namespace) {
+	namespace := ns.Name
+	for _, resource := range w.resourceNames() {
+		objects, err := w.listObjects(resource, labels.Everything())
+		if err != nil {
+			fmt.Printf("Error listing %s: %v\n", resource, err)
+			continue
+		}
+		for _, obj := range objects {
+			if HasSyncSourceLabel(obj) && targetsNamespace(obj, ns) {
+				fmt.Printf("Namespace %s is a target of %s/%s, syncing...\n", namespace, obj.GetNamespace(), obj.GetName())
+				w.enqueue(resource, obj)
+			}
+		}
+	}
+}
+
+// forgetNamespace drops a deleted namespace from the synced targets of every source,
+// so it is not pruned (or marked stale) later on.
+func (w *Watcher) forgetNamespace(namespace string) {
+	w.sourcesMu.Lock()
+	defer w.sourcesMu.Unlock()
+	for _, state := range w.sources {
+		state.targets = differenceNamespaces(state.targets, []string{namespace})
+	}
+}
+
+func containsNamespace(namespaces []string, namespace string) bool {
+	for _, ns := range namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// unionNamespaces returns every namespace that is in a or b.
+func unionNamespaces(a, b []string) []string {
+	return FilterNamespaces(append(append([]string{}, a...), b...), nil)
+}
+
+// differenceNamespaces returns the namespaces in a that are not in b.
+func differenceNamespaces(a, b []string) []string {
+	return FilterNamespaces(a, b)
+}
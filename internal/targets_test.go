@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func namespace(name string, labels, annotations map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels, Annotations: annotations}}
+}
+
+func TestTargetsNamespace(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		ns          *corev1.Namespace
+		want        bool
+	}{
+		{
+			name:        "listed by name",
+			annotations: map[string]string{TargetsAnnotation: "staging, prod"},
+			ns:          namespace("prod", nil, nil),
+			want:        true,
+		},
+		{
+			name:        "not listed",
+			annotations: map[string]string{TargetsAnnotation: "staging"},
+			ns:          namespace("prod", nil, nil),
+		},
+		{
+			name:        "glob",
+			annotations: map[string]string{TargetsAnnotation: "tenant-*"},
+			ns:          namespace("tenant-a", nil, nil),
+			want:        true,
+		},
+		{
+			name:        "regular expression",
+			annotations: map[string]string{TargetsAnnotation: "re:^prod-[a-z]+$"},
+			ns:          namespace("prod-eu", nil, nil),
+			want:        true,
+		},
+		{
+			name:        "excluded by pattern",
+			annotations: map[string]string{TargetsAnnotation: "*", ExcludeAnnotation: "kube-*"},
+			ns:          namespace("kube-system", nil, nil),
+		},
+		{
+			name:        "never its own namespace",
+			annotations: map[string]string{TargetsAnnotation: "*"},
+			ns:          namespace("default", nil, nil),
+		},
+		{
+			name:        "selector",
+			annotations: map[string]string{TargetSelectorAnnotation: "team=payments"},
+			ns:          namespace("payments", map[string]string{"team": "payments"}, nil),
+			want:        true,
+		},
+		{
+			name:        "selector does not match",
+			annotations: map[string]string{TargetSelectorAnnotation: "team=payments"},
+			ns:          namespace("search", map[string]string{"team": "search"}, nil),
+		},
+		{
+			name:        "opted out of this source",
+			annotations: map[string]string{TargetsAnnotation: "*"},
+			ns:          namespace("tenant-a", nil, map[string]string{OptOutAnnotation: "app.default"}),
+		},
+		{
+			name:        "opted out of another source",
+			annotations: map[string]string{TargetsAnnotation: "*"},
+			ns:          namespace("tenant-a", nil, map[string]string{OptOutAnnotation: "other.default"}),
+			want:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := configMap("default", "app", nil, tt.annotations, nil)
+			if got := targetsNamespace(source, tt.ns); got != tt.want {
+				t.Errorf("targetsNamespace = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceMatcher(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+		wantErr bool
+	}{
+		{pattern: "*", name: "anything", want: true},
+		{pattern: "tenant-*", name: "tenant-a", want: true},
+		{pattern: "tenant-*", name: "prod", want: false},
+		{pattern: "tenant-?", name: "tenant-ab", want: false},
+		{pattern: "re:^prod-[a-z]+$", name: "prod-eu", want: true},
+		{pattern: "re:^prod-[a-z]+$", name: "prod-1", want: false},
+		{pattern: "re:prod", name: "preprod", want: true},
+		{pattern: "re:[", wantErr: true},
+		{pattern: "tenant-[", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.name, func(t *testing.T) {
+			match, err := namespaceMatcher(tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("namespaceMatcher(%q) error = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := match(tt.name); got != tt.want {
+				t.Errorf("match(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,45 +2,94 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
-	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
-	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/dynamic"
 )
 
-func UpdateResource(clientset *k8s.Clientset, obj interface{}, strategy string, namespace string, name string) {
+// Values of the mirrorverse.dev/strategy label
+const (
+	StrategyReplace = "replace"
+	StrategyPatch   = "patch"
+	StrategyMerge3  = "merge3"
+	StrategyApply   = "apply"
+)
+
+// UpdateResource writes obj over the existing replica namespace/name using the given strategy.
+//   - replace: the replica becomes an exact copy of the source. obj must carry the
+//     resourceVersion of the live replica: custom resources refuse updates without it
+//   - patch:   source keys overwrite replica keys, keys only present in the replica are kept
+//   - merge3:  like patch, but keys Mirrorverse wrote earlier and the source dropped are removed
+//
+// The apply strategy does not go through here: CreateResource applies directly.
+// It returns the written replica.
+func UpdateResource(ctx context.Context, client dynamic.NamespaceableResourceInterface, obj *unstructured.Unstructured, strategy string, namespace string, name string) (*unstructured.Unstructured, error) {
 	var err error
-	switch o := obj.(type) {
-	case *corev1.ConfigMap:
-		if strategy == "replace" {
-			_, err = clientset.CoreV1().ConfigMaps(namespace).Update(context.TODO(), o, v1.UpdateOptions{})
-		} else if strategy == "patch" {
-			_, err = clientset.CoreV1().ConfigMaps(namespace).Patch(context.TODO(), name, types.MergePatchType, []byte("{}"), v1.PatchOptions{})
+	var patch []byte
+	var written *unstructured.Unstructured
+	switch strategy {
+	case StrategyReplace:
+		written, err = client.Namespace(namespace).Update(ctx, obj, v1.UpdateOptions{})
+	case StrategyPatch, StrategyMerge3:
+		if strategy == StrategyPatch {
+			patch, err = buildMergePatch(obj)
 		} else {
-			fmt.Printf("Unknown strategy '%s' for ConfigMap '%s' in namespace '%s'\n", strategy, name, namespace)
-			return
+			patch, err = buildThreeWayPatch(ctx, client, obj, namespace, name)
 		}
 		if err != nil {
-			fmt.Printf("Failed to update ConfigMap '%s' in namespace '%s' with strategy '%s': %v\n", name, namespace,strategy, err)
-		} else {
-			fmt.Printf("Updated ConfigMap '%s' in namespace '%s' with strategy '%s' \n", name, namespace,strategy)
+			return nil, fmt.Errorf("building %s patch for '%s' in namespace '%s': %w", strategy, name, namespace, err)
 		}
-	case *corev1.Secret:
-		if strategy == "replace" {
-			_, err = clientset.CoreV1().Secrets(namespace).Update(context.TODO(), o, v1.UpdateOptions{})
-		} else if strategy == "patch" {
-			// Example: patch with empty merge (customize as needed)
-			_, err = clientset.CoreV1().Secrets(namespace).Patch(context.TODO(), name, types.MergePatchType, []byte("{}"), v1.PatchOptions{})
-		} else {
-			fmt.Printf("Unknown strategy '%s' for Secret '%s' in namespace '%s'\n", strategy, name, namespace)
-			return
+		written, err = client.Namespace(namespace).Patch(ctx, name, types.MergePatchType, patch, v1.PatchOptions{})
+	default:
+		return nil, fmt.Errorf("unknown strategy '%s' for %s '%s' in namespace '%s'", strategy, obj.GetKind(), name, namespace)
+	}
+	if err != nil {
+		fmt.Printf("Failed to update %s '%s' in namespace '%s' with strategy '%s': %v\n", obj.GetKind(), name, namespace, strategy, err)
+	} else {
+		fmt.Printf("Updated %s '%s' in namespace '%s' with strategy '%s'\n", obj.GetKind(), name, namespace, strategy)
+	}
+	return written, err
+}
+
+// buildMergePatch returns a JSON merge patch (RFC 7386) carrying the source's labels,
+// annotations and content. A merge patch only touches the keys it mentions, so keys the
+// replica has on its own survive inside maps like `data`; lists (e.g. a Role's `rules`)
+// are replaced as a whole. Empty maps are left out on purpose.
+func buildMergePatch(obj *unstructured.Unstructured) ([]byte, error) {
+	patch, err := mergePatchFor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(patch)
+}
+
+func mergePatchFor(obj *unstructured.Unstructured) (map[string]interface{}, error) {
+	metadata := map[string]interface{}{}
+	labels := map[string]interface{}{}
+	for k, v := range obj.GetLabels() {
+		labels[k] = v
+	}
+	// Replicas written before the move to annotations still carry these as labels,
+	// and a replica that was marked stale is managed again
+	for _, k := range []string{SyncSourceRefAnnotation, LastSyncedAnnotation, StrategyAnnotation, "mirrorverse.dev/stale"} {
+		if _, ok := labels[k]; !ok {
+			labels[k] = nil
 		}
-		if err != nil {
-			fmt.Printf("Failed to update Secret '%s' in namespace '%s' with strategy '%s': %v\n", name, namespace,strategy, err)
-		} else {
-			fmt.Printf("Updated Secret '%s' in namespace '%s' with strategy '%s'\n", name, namespace,strategy)
+	}
+	metadata["labels"] = labels
+	if annotations := obj.GetAnnotations(); len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+	patch := map[string]interface{}{"metadata": metadata}
+	for _, field := range contentFields(obj) {
+		if m, ok := obj.Object[field].(map[string]interface{}); ok && len(m) == 0 {
+			continue
 		}
+		patch[field] = obj.Object[field]
 	}
+	return patch, nil
 }
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+var configMapGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+func configMap(namespace, name string, labels, annotations map[string]string, data map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+	}}
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(labels)
+	obj.SetAnnotations(annotations)
+	if data != nil {
+		obj.Object["data"] = data
+	}
+	return obj
+}
+
+func TestMergePatchFor(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  *unstructured.Unstructured
+		want map[string]interface{}
+	}{
+		{
+			name: "labels, annotations and data",
+			obj: configMap("staging", "app", map[string]string{"team": "a"}, map[string]string{"note": "x"},
+				map[string]interface{}{"key": "value"}),
+			want: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{
+						"team":                  "a",
+						SyncSourceRefAnnotation: nil,
+						LastSyncedAnnotation:    nil,
+						StrategyAnnotation:      nil,
+						"mirrorverse.dev/stale": nil,
+					},
+					"annotations": map[string]string{"note": "x"},
+				},
+				"data": map[string]interface{}{"key": "value"},
+			},
+		},
+		{
+			name: "empty maps are left out",
+			obj:  configMap("staging", "app", nil, nil, map[string]interface{}{}),
+			want: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{
+						SyncSourceRefAnnotation: nil,
+						LastSyncedAnnotation:    nil,
+						StrategyAnnotation:      nil,
+						"mirrorverse.dev/stale": nil,
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergePatchFor(tt.obj)
+			if err != nil {
+				t.Fatalf("mergePatchFor: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergePatchFor = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildMergePatchIsJSON(t *testing.T) {
+	obj := configMap("staging", "app", nil, nil, map[string]interface{}{"key": "value"})
+	patch, err := buildMergePatch(obj)
+	if err != nil {
+		t.Fatalf("buildMergePatch: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(patch, &decoded); err != nil {
+		t.Fatalf("patch is not JSON: %v", err)
+	}
+	if got := decoded["data"]; !reflect.DeepEqual(got, map[string]interface{}{"key": "value"}) {
+		t.Errorf("data = %v, want key=value", got)
+	}
+}
+
+func TestUpdateResourceKeepsReplicaKeys(t *testing.T) {
+	replica := configMap("staging", "app", map[string]string{"team": "a"}, nil, map[string]interface{}{
+		"shared": "old",
+		"local":  "added in the replica",
+	})
+	source := configMap("staging", "app", map[string]string{"team": "a"}, nil, map[string]interface{}{
+		"shared": "new",
+	})
+
+	tests := []struct {
+		strategy string
+		want     map[string]string
+	}{
+		{StrategyPatch, map[string]string{"shared": "new", "local": "added in the replica"}},
+		{StrategyReplace, map[string]string{"shared": "new"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			client := fake.NewSimpleDynamicClient(runtime.NewScheme(), replica.DeepCopy())
+			if _, err := UpdateResource(context.Background(), client.Resource(configMapGVR), source.DeepCopy(), tt.strategy, "staging", "app"); err != nil {
+				t.Fatalf("UpdateResource: %v", err)
+			}
+			got, err := client.Resource(configMapGVR).Namespace("staging").Get(context.Background(), "app", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("get replica: %v", err)
+			}
+			data, _, _ := unstructured.NestedStringMap(got.Object, "data")
+			if !reflect.DeepEqual(data, tt.want) {
+				t.Errorf("data = %v, want %v", data, tt.want)
+			}
+		})
+	}
+}
@@ -1,19 +1,90 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"k8s-syncer/client"
 	"k8s-syncer/internal"
-
-)	
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
 
 func main() {
+	workers := flag.Int("workers", 2, "number of workers reconciling sources and replicas in parallel")
+	resyncInterval := flag.Duration("resync-interval", 5*time.Minute, "how often every source and replica is re-checked for drift (0 disables)")
+	reconcileTimeout := flag.Duration("reconcile-timeout", 30*time.Second, "timeout for the API calls made while reconciling a single object")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 20*time.Second, "how long in-flight reconciles may finish after SIGTERM before they are cancelled")
+	leaderElect := flag.Bool("leader-elect", true, "use a Lease so only one controller replica reconciles at a time")
+	leaseName := flag.String("leader-election-lease-name", "mirrorverse", "name of the leader election Lease")
+	leaseNamespace := flag.String("leader-election-namespace", "", "namespace of the leader election Lease (defaults to the pod's namespace)")
+	leaseDuration := flag.Duration("leader-election-lease-duration", 15*time.Second, "how long standbys wait before taking over an expired lease")
+	renewDeadline := flag.Duration("leader-election-renew-deadline", 10*time.Second, "how long the leader retries renewing before giving up")
+	retryPeriod := flag.Duration("leader-election-retry-period", 2*time.Second, "how often candidates try to acquire or renew the lease")
+	resources := flag.String("resources", strings.Join(internal.DefaultResources, ","), "comma-separated namespaced resources to mirror, as resource or resource.group (e.g. networkpolicies.networking.k8s.io)")
+	rbacSourceNamespaces := flag.String("rbac-source-namespaces", "", "comma-separated namespaces Roles and RoleBindings may be mirrored from without a ClusterMirrorPolicy")
+	metricsAddr := flag.String("metrics-addr", ":8080", "address the Prometheus metrics are served on at /metrics (empty disables)")
+	flag.Parse()
+
 	fmt.Println("Starting the k8s-syncer controller...")
 
-	k8sClient := client.GetKubeClient()
+	// cancel the root context on SIGTERM/SIGINT so everything below shuts down cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if *metricsAddr != "" {
+		// every pod serves metrics, leader or standby
+		go func() {
+			if err := internal.ServeMetrics(ctx, *metricsAddr); err != nil {
+				fmt.Printf("Metrics server failed: %v\n", err)
+			}
+		}()
+	}
 
-	// set up the watcher
-	internal.CreateWatcher(k8sClient)
+	config := client.GetRestConfig()
+	// count failed API requests in mirrorverse_api_errors_total
+	config.Wrap(internal.InstrumentTransport)
+	k8sClient := client.GetKubeClient(config)
+	dynamicClient := client.GetDynamicClient(config)
+	opts := internal.WatcherOptions{
+		Resources:            strings.Split(*resources, ","),
+		RBACSourceNamespaces: strings.Split(*rbacSourceNamespaces, ","),
+		Workers:              *workers,
+		ResyncInterval:       *resyncInterval,
+		ReconcileTimeout:     *reconcileTimeout,
+		ShutdownTimeout:      *shutdownTimeout,
+	}
 
+	if !*leaderElect {
+		// set up the watcher
+		if err := internal.CreateWatcher(ctx, k8sClient, dynamicClient, opts); err != nil {
+			fmt.Printf("Watcher failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Stopped the k8s-syncer controller")
+		return
+	}
 
+	// only the leader sets up the watcher
+	var watcherErr error
+	err := internal.RunWithLeaderElection(ctx, k8sClient, internal.LeaderElectionOptions{
+		LeaseName:      *leaseName,
+		LeaseNamespace: *leaseNamespace,
+		LeaseDuration:  *leaseDuration,
+		RenewDeadline:  *renewDeadline,
+		RetryPeriod:    *retryPeriod,
+	}, func(ctx context.Context) {
+		watcherErr = internal.CreateWatcher(ctx, k8sClient, dynamicClient, opts)
+	})
+	if err == nil {
+		err = watcherErr
+	}
+	if err != nil {
+		fmt.Printf("Controller failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Stopped the k8s-syncer controller")
 }